@@ -0,0 +1,111 @@
+package filewatch
+
+import (
+	"sync"
+	"time"
+)
+
+// ackState 内容的确认状态
+type ackState int
+
+const (
+	ackPending  ackState = iota // 已发送, 等待确认
+	ackDone                     // 已确认
+	ackRejected                 // 被拒绝, 等待重新发送
+)
+
+// ackEntry 确认模式下已发送的一条内容
+type ackEntry struct {
+	t       *ackTracker
+	content FileContent // 重新发送时使用的内容
+	offset  int64       // 内容末尾对应的游标
+	line    int64
+	sentAt  time.Time
+	state   ackState
+}
+
+// ackTracker 按发送顺序记录单个文件已发送但尚未提交的内容
+type ackTracker struct {
+	mu      sync.Mutex
+	entries []*ackEntry
+	notify  chan struct{} // 收到Ack或Nack时通知监听协程
+}
+
+func newAckTracker() *ackTracker {
+	return &ackTracker{notify: make(chan struct{}, 1)}
+}
+
+// add 记录即将发送的内容, 返回带有确认信息的内容; offset、line为内容末尾对应的游标
+func (t *ackTracker) add(c FileContent, offset, line int64) FileContent {
+	e := &ackEntry{t: t, offset: offset, line: line, sentAt: time.Now()}
+	c.ack = e
+	e.content = c
+	t.mu.Lock()
+	t.entries = append(t.entries, e)
+	t.mu.Unlock()
+	return c
+}
+
+// settle 更新内容的确认状态, 已确认的内容不再改变
+func (t *ackTracker) settle(e *ackEntry, state ackState) {
+	t.mu.Lock()
+	if e.state != ackDone {
+		e.state = state
+	}
+	t.mu.Unlock()
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+// commit 移除开头连续已确认的内容, 返回其中最后一条对应的游标, 没有可提交的内容时ok为false
+func (t *ackTracker) commit() (offset, line int64, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for n < len(t.entries) && t.entries[n].state == ackDone {
+		offset, line, ok = t.entries[n].offset, t.entries[n].line, true
+		n++
+	}
+	t.entries = t.entries[n:]
+	return offset, line, ok
+}
+
+// due 返回需要重新发送的内容: 被拒绝的, 以及timeout大于0时超时未确认的; 返回的内容重新开始计时
+func (t *ackTracker) due(timeout time.Duration) []FileContent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var res []FileContent
+	now := time.Now()
+	for _, e := range t.entries {
+		expired := timeout > 0 && e.state == ackPending && now.Sub(e.sentAt) >= timeout
+		if e.state == ackRejected || expired {
+			e.state, e.sentAt = ackPending, now
+			res = append(res, e.content)
+		}
+	}
+	return res
+}
+
+// pending 尚未提交的内容数量
+func (t *ackTracker) pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.entries)
+}
+
+// Ack 确认内容已处理完毕, 仅在确认模式(见WithAckMode)下有效, 重复调用无影响.
+// 同一文件的内容按发送顺序提交, 之前发送的内容均已确认后游标才会越过该内容
+func (f FileContent) Ack() {
+	if f.ack != nil {
+		f.ack.t.settle(f.ack, ackDone)
+	}
+}
+
+// Nack 告知内容处理失败, 该内容会被重新发送, 仅在确认模式下有效; 已确认的内容调用无影响
+func (f FileContent) Nack() {
+	if f.ack != nil {
+		f.ack.t.settle(f.ack, ackRejected)
+	}
+}
@@ -0,0 +1,249 @@
+package filewatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileWatcherConfig 配置文件的内容, 字段与各Option一一对应, 未填写的字段使用默认配置.
+// 时长字段使用time.ParseDuration的格式(如"30s"、"4h"), JSON示例:
+//
+//	{
+//	  "dirs": ["./logs"],
+//	  "file_regexp": "\\.log$",
+//	  "complete_marker": "LOG_COMPLETE",
+//	  "remove_after_complete": true,
+//	  "max_no_update_time": "4h",
+//	  "cursor_dir": "/var/lib/filewatch",
+//	  "profiles": [
+//	    {"name": "job", "regexp": "^job-", "complete_marker": "DONE", "remove_after_complete": true}
+//	  ]
+//	}
+//
+// 等价的YAML:
+//
+//	dirs: [./logs]
+//	file_regexp: '\.log$'
+//	complete_marker: LOG_COMPLETE
+//	remove_after_complete: true
+//	max_no_update_time: 4h
+//	cursor_dir: /var/lib/filewatch
+//	profiles:
+//	  - {name: job, regexp: '^job-', complete_marker: DONE, remove_after_complete: true}
+type FileWatcherConfig struct {
+	Dirs                 []string        `json:"dirs" yaml:"dirs"`
+	FileRegexp           string          `json:"file_regexp,omitempty" yaml:"file_regexp,omitempty"`
+	FileGlob             string          `json:"file_glob,omitempty" yaml:"file_glob,omitempty"`
+	FilePatterns         []string        `json:"file_patterns,omitempty" yaml:"file_patterns,omitempty"`
+	Profiles             []ProfileConfig `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+	ExcludeFileRegexp    string          `json:"exclude_file_regexp,omitempty" yaml:"exclude_file_regexp,omitempty"`
+	ExcludeFileRegexps   []string        `json:"exclude_file_regexps,omitempty" yaml:"exclude_file_regexps,omitempty"`
+	ExcludeDirRegexp     string          `json:"exclude_dir_regexp,omitempty" yaml:"exclude_dir_regexp,omitempty"`
+	MatchBaseName        bool            `json:"match_base_name,omitempty" yaml:"match_base_name,omitempty"`
+	CaseInsensitiveMatch bool            `json:"case_insensitive_match,omitempty" yaml:"case_insensitive_match,omitempty"`
+	CompleteMarker       string          `json:"complete_marker,omitempty" yaml:"complete_marker,omitempty"`
+	CompleteMarkerRegexp string          `json:"complete_marker_regexp,omitempty" yaml:"complete_marker_regexp,omitempty"`
+	RemoveAfterComplete  bool            `json:"remove_after_complete,omitempty" yaml:"remove_after_complete,omitempty"`
+	MaxNoUpdateTime      Duration        `json:"max_no_update_time,omitempty" yaml:"max_no_update_time,omitempty"`
+	ResChanBuffer        int             `json:"res_chan_buffer,omitempty" yaml:"res_chan_buffer,omitempty"`
+	StopTimeout          Duration        `json:"stop_timeout,omitempty" yaml:"stop_timeout,omitempty"`
+	RescanInterval       Duration        `json:"rescan_interval,omitempty" yaml:"rescan_interval,omitempty"`
+	PollingInterval      Duration        `json:"polling_interval,omitempty" yaml:"polling_interval,omitempty"`
+	MaxConcurrentFiles   int             `json:"max_concurrent_files,omitempty" yaml:"max_concurrent_files,omitempty"`
+	WaitForDir           Duration        `json:"wait_for_dir,omitempty" yaml:"wait_for_dir,omitempty"`
+	MaxBatchBytes        int64           `json:"max_batch_bytes,omitempty" yaml:"max_batch_bytes,omitempty"`
+	FlushInterval        Duration        `json:"flush_interval,omitempty" yaml:"flush_interval,omitempty"`
+	CompressContent      bool            `json:"compress_content,omitempty" yaml:"compress_content,omitempty"`
+	MaxFileSize          int64           `json:"max_file_size,omitempty" yaml:"max_file_size,omitempty"`
+	TruncateToEnd        bool            `json:"truncate_to_end,omitempty" yaml:"truncate_to_end,omitempty"`
+	TailOversize         bool            `json:"tail_oversize,omitempty" yaml:"tail_oversize,omitempty"`
+	MaxLineBytes         int             `json:"max_line_bytes,omitempty" yaml:"max_line_bytes,omitempty"`
+	TailExisting         bool            `json:"tail_existing,omitempty" yaml:"tail_existing,omitempty"`
+	MinFileAge           Duration        `json:"min_file_age,omitempty" yaml:"min_file_age,omitempty"`
+	SkipBinary           bool            `json:"skip_binary,omitempty" yaml:"skip_binary,omitempty"`
+	DeferEmptyFiles      bool            `json:"defer_empty_files,omitempty" yaml:"defer_empty_files,omitempty"`
+	RotationGrace        Duration        `json:"rotation_grace,omitempty" yaml:"rotation_grace,omitempty"`
+	CursorDir            string          `json:"cursor_dir,omitempty" yaml:"cursor_dir,omitempty"`
+	CursorSaveInterval   Duration        `json:"cursor_save_interval,omitempty" yaml:"cursor_save_interval,omitempty"`
+	CursorPerDelivery    bool            `json:"cursor_per_delivery,omitempty" yaml:"cursor_per_delivery,omitempty"`
+	CursorSync           *bool           `json:"cursor_sync,omitempty" yaml:"cursor_sync,omitempty"` // 默认为true
+	InMemoryCursors      bool            `json:"in_memory_cursors,omitempty" yaml:"in_memory_cursors,omitempty"`
+	AckMode              bool            `json:"ack_mode,omitempty" yaml:"ack_mode,omitempty"`
+	AckTimeout           Duration        `json:"ack_timeout,omitempty" yaml:"ack_timeout,omitempty"`
+	RefuseBadCursor      bool            `json:"refuse_bad_cursor,omitempty" yaml:"refuse_bad_cursor,omitempty"`
+	Decompress           bool            `json:"decompress,omitempty" yaml:"decompress,omitempty"`
+	FollowSymlinks       bool            `json:"follow_symlinks,omitempty" yaml:"follow_symlinks,omitempty"`
+	Recursive            *bool           `json:"recursive,omitempty" yaml:"recursive,omitempty"` // 默认为true
+	MaxDepth             int             `json:"max_depth,omitempty" yaml:"max_depth,omitempty"`
+	IgnoreHidden         *bool           `json:"ignore_hidden,omitempty" yaml:"ignore_hidden,omitempty"` // 默认为true
+}
+
+// ProfileConfig 配置文件中的Profile
+type ProfileConfig struct {
+	Name                string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Regexp              string            `json:"regexp" yaml:"regexp"`
+	CompleteMarker      string            `json:"complete_marker,omitempty" yaml:"complete_marker,omitempty"`
+	RemoveAfterComplete bool              `json:"remove_after_complete,omitempty" yaml:"remove_after_complete,omitempty"`
+	MaxNoUpdateTime     Duration          `json:"max_no_update_time,omitempty" yaml:"max_no_update_time,omitempty"`
+	Tags                map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+// Duration 配置文件中的时长, 以time.ParseDuration的格式表示
+type Duration time.Duration
+
+// UnmarshalJSON 解析"30s"这类时长字符串
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("时长需为字符串(如\"30s\"): %w", err)
+	}
+	dur, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(dur)
+	return nil
+}
+
+// MarshalJSON 序列化为时长字符串
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalYAML 解析"30s"这类时长字符串
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return fmt.Errorf("时长需为字符串(如\"30s\"): %w", err)
+	}
+	dur, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(dur)
+	return nil
+}
+
+// MarshalYAML 序列化为时长字符串
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+// NewWatcherFromConfig 读取配置文件创建watcher, 按扩展名支持JSON(.json)与YAML(.yaml、.yml)格式, 配置文件的格式见FileWatcherConfig.
+// 配置文件中未知的字段视为错误; opts在配置文件之后应用, 可用于设置回调函数等无法写入配置文件的配置
+func NewWatcherFromConfig(configPath string, opts ...Option) (*FileWatcher, error) {
+	ext := strings.ToLower(filepath.Ext(configPath))
+	if ext != ".json" && ext != ".yaml" && ext != ".yml" {
+		return nil, fmt.Errorf("不支持的配置文件格式: %s", ext)
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	var cfg FileWatcherConfig
+	if ext == ".json" {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&cfg)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		// 空文件等同于未填写任何字段
+		if err = dec.Decode(&cfg); errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件(%s)失败: %w", configPath, err)
+	}
+	cfgOpts, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+	return NewWatcher(append(cfgOpts, opts...)...)
+}
+
+// Options 将配置转换为Option列表, 未填写的字段不生成Option
+func (c *FileWatcherConfig) Options() ([]Option, error) {
+	var opts []Option
+	add := func(set bool, opt Option) {
+		if set {
+			opts = append(opts, opt)
+		}
+	}
+	// 忽略大小写需在各正则表达式之前设置
+	add(c.CaseInsensitiveMatch, WithCaseInsensitiveMatch(true))
+	add(len(c.Dirs) > 0, WithDirs(c.Dirs...))
+	add(c.FileRegexp != "", WithFileRegexp(c.FileRegexp))
+	add(c.FileGlob != "", WithFileGlob(c.FileGlob))
+	for _, expr := range c.FilePatterns {
+		opts = append(opts, WithFilePattern(expr))
+	}
+	for _, p := range c.Profiles {
+		opts = append(opts, WithProfile(Profile{
+			Name:                p.Name,
+			Regexp:              p.Regexp,
+			CompleteMarker:      p.CompleteMarker,
+			RemoveAfterComplete: p.RemoveAfterComplete,
+			MaxNoUpdateTime:     time.Duration(p.MaxNoUpdateTime),
+			Tags:                p.Tags,
+		}))
+	}
+	add(c.ExcludeFileRegexp != "", WithExcludeFileRegexp(c.ExcludeFileRegexp))
+	// 同时设置时两者均生效
+	add(len(c.ExcludeFileRegexps) > 0, WithExcludeFileRegexps(append([]string{c.ExcludeFileRegexp}, c.ExcludeFileRegexps...)...))
+	add(c.ExcludeDirRegexp != "", WithExcludeDirRegexp(c.ExcludeDirRegexp))
+	add(c.MatchBaseName, WithMatchBaseName(true))
+	add(c.CompleteMarker != "", WithCompleteMarker(c.CompleteMarker))
+	if c.CompleteMarkerRegexp != "" {
+		re, err := regexp.Compile(c.CompleteMarkerRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidRegexp, c.CompleteMarkerRegexp, err)
+		}
+		opts = append(opts, WithCompleteMarkerRegexp(re))
+	}
+	add(c.RemoveAfterComplete, WithRemoveAfterComplete(true))
+	add(c.MaxNoUpdateTime != 0, WithMaxNoUpdateTime(time.Duration(c.MaxNoUpdateTime)))
+	add(c.ResChanBuffer != 0, WithResChanBuffer(c.ResChanBuffer))
+	add(c.StopTimeout != 0, WithStopTimeout(time.Duration(c.StopTimeout)))
+	add(c.RescanInterval != 0, WithRescanInterval(time.Duration(c.RescanInterval)))
+	add(c.PollingInterval != 0, WithPollingInterval(time.Duration(c.PollingInterval)))
+	add(c.MaxConcurrentFiles != 0, WithMaxConcurrentFiles(c.MaxConcurrentFiles))
+	add(c.WaitForDir != 0, WithWaitForDir(time.Duration(c.WaitForDir)))
+	add(c.MaxBatchBytes != 0, WithMaxBatchBytes(c.MaxBatchBytes))
+	add(c.FlushInterval != 0, WithFlushInterval(time.Duration(c.FlushInterval)))
+	add(c.CompressContent, WithCompressContent(true))
+	add(c.MaxFileSize != 0, WithMaxFileSize(c.MaxFileSize))
+	add(c.TruncateToEnd, WithTruncateToEnd(true))
+	add(c.TailOversize, WithTailOversize(true))
+	add(c.MaxLineBytes != 0, WithMaxLineBytes(c.MaxLineBytes))
+	add(c.TailExisting, WithTailExisting(true))
+	add(c.MinFileAge != 0, WithMinFileAge(time.Duration(c.MinFileAge)))
+	add(c.SkipBinary, WithSkipBinary(true))
+	add(c.DeferEmptyFiles, WithDeferEmptyFiles(true))
+	add(c.RotationGrace != 0, WithRotationGrace(time.Duration(c.RotationGrace)))
+	add(c.CursorDir != "", WithCursorDir(c.CursorDir))
+	add(c.CursorSaveInterval != 0, WithCursorSaveInterval(time.Duration(c.CursorSaveInterval)))
+	add(c.CursorPerDelivery, WithCursorGranularity(CursorPerDelivery))
+	add(c.CursorSync != nil, WithCursorSync(c.CursorSync != nil && *c.CursorSync))
+	add(c.InMemoryCursors, WithInMemoryCursors())
+	add(c.AckMode, WithAckMode(true))
+	add(c.AckTimeout != 0, WithAckTimeout(time.Duration(c.AckTimeout)))
+	add(c.RefuseBadCursor, WithRefuseBadCursor(true))
+	add(c.Decompress, WithDecompress(true))
+	add(c.FollowSymlinks, WithFollowSymlinks(true))
+	add(c.Recursive != nil, WithRecursive(c.Recursive != nil && *c.Recursive))
+	add(c.MaxDepth != 0, WithMaxDepth(c.MaxDepth))
+	add(c.IgnoreHidden != nil, WithIgnoreHidden(c.IgnoreHidden != nil && *c.IgnoreHidden))
+	return opts, nil
+}
@@ -0,0 +1,56 @@
+package filewatch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigYAML(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "filewatch.yaml")
+	data := `
+dirs: [` + dir + `]
+file_regexp: '\.log$'
+complete_marker: LOG_COMPLETE
+max_no_update_time: 90m
+cursor_sync: false
+profiles:
+  - {name: job, regexp: '^job-', complete_marker: DONE}
+`
+	if err := os.WriteFile(configPath, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcherFromConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.maxNoUpdateTime != 90*time.Minute {
+		t.Errorf("maxNoUpdateTime = %v, want 90m", w.maxNoUpdateTime)
+	}
+	if w.completeMarker != "LOG_COMPLETE" {
+		t.Errorf("completeMarker = %q, want LOG_COMPLETE", w.completeMarker)
+	}
+	if w.cursorSync {
+		t.Error("cursor_sync: false was ignored")
+	}
+}
+
+func TestConfigYAMLRejectsUnknownFields(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"unknown.yml":  "dirs: [" + dir + "]\nmax_no_update: 1h\n",
+		"duration.yml": "dirs: [" + dir + "]\nmax_no_update_time: 1\n",
+		"unknown.json": `{"dirs": ["` + dir + `"], "max_no_update": "1h"}`,
+	} {
+		configPath := filepath.Join(dir, name)
+		if err := os.WriteFile(configPath, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewWatcherFromConfig(configPath); err == nil || !strings.Contains(err.Error(), "解析配置文件") {
+			t.Errorf("%s: err = %v, want parse error", name, err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package filewatch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// Cursor 文件的读取位置, 以及用于判断文件是否被替换的文件标识.
+// 恢复读取时文件标识与当前文件不一致(如文件被删除后重新创建), 则认为是新文件, 从头读取
+type Cursor struct {
+	Offset int64 `json:"offset"` // 已读取到的文件偏移量
+	Line   int64 `json:"line"`   // 偏移量之前的行数, 用于计算FileContent的行号; 为0且Offset不为0时表示未知
+
+	Dev      uint64 `json:"dev,omitempty"`       // 文件所在的设备号, 与Inode共同标识文件, 平台不支持时为0
+	Inode    uint64 `json:"inode,omitempty"`     // 文件的inode
+	Size     int64  `json:"size,omitempty"`      // 保存游标时的文件大小
+	HeadLen  int64  `json:"head_len,omitempty"`  // 参与校验的文件开头的字节数, 最多cursorHeadSize
+	HeadHash string `json:"head_hash,omitempty"` // 文件开头HeadLen个字节的SHA-256
+
+	Path string `json:"path,omitempty"` // 被监听文件的绝对路径, 仅游标目录中的游标文件记录, 用于清理文件已不存在的游标
+}
+
+// cursorHeadSize 游标中校验的文件开头的最大字节数
+const cursorHeadSize = 1024
+
+// identified 游标是否记录了文件标识, 旧版本的游标只有偏移量
+func (c Cursor) identified() bool {
+	return c.Inode != 0 || c.HeadLen > 0
+}
+
+// identify 记录文件的当前标识. 读取文件开头时使用ReadAt, 不影响文件的读取位置
+func (c *Cursor) identify(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	c.Dev, c.Inode, _ = fileID(info)
+	c.Size = info.Size()
+	c.HeadLen, c.HeadHash, err = headHash(f, min(info.Size(), cursorHeadSize))
+	return err
+}
+
+// sameFile 判断f是否仍是游标记录的文件, 未记录文件标识时认为是同一文件
+func (c Cursor) sameFile(f *os.File) (bool, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if dev, ino, ok := fileID(info); ok && c.Inode != 0 && (dev != c.Dev || ino != c.Inode) {
+		return false, nil
+	}
+	if c.HeadLen == 0 {
+		return true, nil
+	}
+	n, hash, err := headHash(f, c.HeadLen)
+	if err != nil {
+		return false, err
+	}
+	return n == c.HeadLen && hash == c.HeadHash, nil
+}
+
+// headHash 计算文件开头n个字节的SHA-256, 文件不足n个字节时返回实际读取的字节数
+func headHash(f *os.File, n int64) (int64, string, error) {
+	if n == 0 {
+		return 0, "", nil
+	}
+	buf := make([]byte, n)
+	m, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	sum := sha256.Sum256(buf[:m])
+	return int64(m), hex.EncodeToString(sum[:]), nil
+}
+
+// CursorStore 游标的存储方式, 以被监听文件的路径为key. 默认存储为游标文件, 见WithCursorDir.
+// 多副本部署、本地磁盘不持久时可实现该接口将游标保存至数据库等外部存储
+type CursorStore interface {
+	// Load 读取文件的游标, 没有游标时返回满足errors.Is(err, fs.ErrNotExist)的错误
+	Load(filePath string) (Cursor, error)
+	// Save 保存文件的游标
+	Save(filePath string, c Cursor) error
+	// Delete 删除文件的游标, 文件读取完毕并被删除时调用
+	Delete(filePath string) error
+}
+
+// fileCursorStore 默认的游标存储, 每个文件的游标保存为一个游标文件
+type fileCursorStore struct {
+	w *FileWatcher
+}
+
+func (s fileCursorStore) Load(filePath string) (Cursor, error) {
+	cursorFile := s.w.cursorPath(filePath)
+	s.w.migrateCursor(filePath, cursorFile)
+	return readCursorFile(cursorFile)
+}
+
+func (s fileCursorStore) Save(filePath string, c Cursor) error {
+	if err := s.w.prepareCursorDir(); err != nil {
+		return err
+	}
+	if s.w.cursorDir != "" {
+		c.Path = fileKey(filePath)
+	}
+	return writeCursorFile(s.w.cursorPath(filePath), c, s.w.cursorSync)
+}
+
+func (s fileCursorStore) Delete(filePath string) error {
+	err := os.Remove(s.w.cursorPath(filePath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// memoryCursorStore 保存在内存中的游标, 不产生游标文件, 进程重启后游标丢失
+type memoryCursorStore struct {
+	mu      sync.Mutex
+	cursors map[string]Cursor
+}
+
+func newMemoryCursorStore() *memoryCursorStore {
+	return &memoryCursorStore{cursors: make(map[string]Cursor)}
+}
+
+func (s *memoryCursorStore) Load(filePath string) (Cursor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.cursors[filePath]
+	if !ok {
+		return Cursor{}, fs.ErrNotExist
+	}
+	return c, nil
+}
+
+func (s *memoryCursorStore) Save(filePath string, c Cursor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cursors[filePath] = c
+	return nil
+}
+
+func (s *memoryCursorStore) Delete(filePath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cursors, filePath)
+	return nil
+}
+
+// cursors 获取当前使用的游标存储
+func (w *FileWatcher) cursors() CursorStore {
+	if w.cursorStore != nil {
+		return w.cursorStore
+	}
+	return fileCursorStore{w: w}
+}
+
+// CursorGranularity 游标的保存粒度
+type CursorGranularity int
+
+const (
+	CursorPerBatch    CursorGranularity = iota // 游标按WithCursorSaveInterval设置的间隔保存, 未设置时每次发送后保存
+	CursorPerDelivery                          // 每发送一次内容都立即保存游标, 忽略保存间隔, 重启后重复发送的内容最少
+)
+
+// cursorSaver 按保存间隔(见WithCursorSaveInterval)保存单个文件的游标, 间隔内的游标只记录在内存中
+type cursorSaver struct {
+	w        *FileWatcher
+	filePath string
+	last     time.Time // 上次写入游标的时间
+
+	// 尚未写入的游标, 写入时才计算文件标识
+	dirty        bool
+	fr           *fileReader
+	offset, line int64
+}
+
+func (w *FileWatcher) newCursorSaver(filePath string) *cursorSaver {
+	return &cursorSaver{w: w, filePath: filePath}
+}
+
+// save 记录游标, 距上次写入已超过保存间隔时立即写入
+func (s *cursorSaver) save(fr *fileReader, offset, line int64) error {
+	s.dirty, s.fr, s.offset, s.line = true, fr, offset, line
+	return s.flushDue()
+}
+
+// saveNow 立即写入游标, 用于文件读取完毕、停止监听等不能遗漏游标的场景
+func (s *cursorSaver) saveNow(fr *fileReader, offset, line int64) error {
+	s.dirty, s.fr, s.offset, s.line = true, fr, offset, line
+	return s.flush()
+}
+
+// flushDue 距上次写入已超过保存间隔时写入尚未写入的游标
+func (s *cursorSaver) flushDue() error {
+	if s.w.cursorGranularity == CursorPerBatch && s.w.cursorSaveInterval > 0 && time.Since(s.last) < s.w.cursorSaveInterval {
+		return nil
+	}
+	return s.flush()
+}
+
+// flush 写入尚未写入的游标
+func (s *cursorSaver) flush() error {
+	if !s.dirty {
+		return nil
+	}
+	s.dirty = false
+	s.last = time.Now()
+	return s.w.saveCursor(s.filePath, s.fr.cursor(s.offset, s.line))
+}
+
+// discard 丢弃尚未写入的游标, 如文件轮转后旧文件的游标已失效
+func (s *cursorSaver) discard() {
+	s.dirty, s.fr = false, nil
+}
+
+// saveCursor 保存文件的游标
+func (w *FileWatcher) saveCursor(filePath string, c Cursor) error {
+	if err := w.cursors().Save(filePath, c); err != nil {
+		return fmt.Errorf("保存文件(%s)的游标失败: %w", filePath, err)
+	}
+	return nil
+}
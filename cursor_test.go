@@ -0,0 +1,263 @@
+package filewatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// drainFile 对只有一个文件的目录调用DrainOnce, 返回读取到的内容及上报的错误
+func drainFile(t *testing.T, dir string, opts ...Option) (string, []error) {
+	t.Helper()
+	var mu sync.Mutex
+	var errs []error
+	opts = append([]Option{WithDir(dir), WithErrorHandler(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	})}, opts...)
+	w, err := NewWatcher(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan string)
+	go func() {
+		var content []byte
+		for c := range w.ResChan {
+			content = append(content, c.Content...)
+		}
+		done <- string(content)
+	}()
+	if err := w.DrainOnce(context.Background()); err != nil {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+	close(w.ResChan)
+	content := <-done
+	mu.Lock()
+	defer mu.Unlock()
+	return content, errs
+}
+
+func TestTornCursorWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"空文件", ""},
+		{"只写入一部分", `{"offset":3,"li`},
+		{"乱码", "\x00\x00\x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filePath := filepath.Join(dir, "a.log")
+			if err := os.WriteFile(filePath, []byte("l1\nl2\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			w, _ := NewWatcher(WithDir(dir))
+			if err := os.WriteFile(w.cursorPath(filePath), []byte(tt.cursor), 0644); err != nil {
+				t.Fatal(err)
+			}
+			content, errs := drainFile(t, dir)
+			if content != "l1\nl2\n" {
+				t.Fatalf("游标损坏时应从头读取, 实际: %q", content)
+			}
+			if len(errs) != 1 || !errors.Is(errs[0], ErrBadCursor) {
+				t.Fatalf("游标损坏时应上报ErrBadCursor, 实际: %v", errs)
+			}
+			// 读取后游标恢复正常
+			c, err := readCursorFile(w.cursorPath(filePath))
+			if err != nil || c.Offset != 6 {
+				t.Fatalf("游标未被重新保存: %+v, %v", c, err)
+			}
+		})
+	}
+}
+
+func TestTornCursorWriteRefused(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(filePath, []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, _ := NewWatcher(WithDir(dir))
+	if err := os.WriteFile(w.cursorPath(filePath), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	content, errs := drainFile(t, dir, WithRefuseBadCursor(true))
+	if content != "" {
+		t.Fatalf("拒绝损坏的游标时不应读取文件, 实际: %q", content)
+	}
+	if len(errs) == 0 || !errors.Is(errs[0], ErrBadCursor) {
+		t.Fatalf("期望ErrBadCursor, 实际: %v", errs)
+	}
+}
+
+// 写入临时文件后、重命名前崩溃时, 原游标文件保持完整
+func TestCursorWriteCrashBeforeRename(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(filePath, []byte("l1\nl2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, _ := NewWatcher(WithDir(dir))
+	cursorFile := w.cursorPath(filePath)
+	if err := writeCursorFile(cursorFile, Cursor{Offset: 3, Line: 1}, false); err != nil {
+		t.Fatal(err)
+	}
+	// 残留的临时文件只写入了一部分
+	tmpFile := filepath.Join(dir, "a.tmp"+CursorFileSuffix)
+	if err := os.WriteFile(tmpFile, []byte(`{"off`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	content, errs := drainFile(t, dir)
+	if content != "l2\n" {
+		t.Fatalf("应从原游标处继续读取, 实际: %q", content)
+	}
+	for _, err := range errs {
+		if errors.Is(err, ErrBadCursor) {
+			t.Fatalf("原游标不应被视为损坏: %v", err)
+		}
+	}
+	// 下次保存时覆盖残留的临时文件
+	if _, err := os.Stat(tmpFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("残留的临时文件未被覆盖: %v", err)
+	}
+}
+
+// 游标变小(如copytruncate轮转后重置)时不能残留旧游标的内容
+func TestCursorShrink(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	for _, opts := range [][]Option{
+		{WithDir(dir)},
+		{WithDir(dir), WithCursorDir(filepath.Join(dir, "cursors"))},
+	} {
+		w, err := NewWatcher(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store := w.cursors()
+		if err := store.Save(filePath, Cursor{Offset: 1500, Line: 100}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Save(filePath, Cursor{Offset: 95, Line: 9}); err != nil {
+			t.Fatal(err)
+		}
+		c, err := store.Load(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Offset != 95 || c.Line != 9 {
+			t.Fatalf("期望游标为95 9, 实际: %d %d", c.Offset, c.Line)
+		}
+	}
+}
+
+// 比较游标文件落盘与否的保存开销: go test -bench CursorSave -run ^$
+func BenchmarkCursorSave(b *testing.B) {
+	for _, sync := range []bool{false, true} {
+		name := "NoSync"
+		if sync {
+			name = "Sync"
+		}
+		b.Run(name, func(b *testing.B) {
+			dir := b.TempDir()
+			filePath := filepath.Join(dir, "a.log")
+			w, err := NewWatcher(WithDir(dir), WithCursorSync(sync))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := w.saveCursor(filePath, Cursor{Offset: int64(i)}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCursorSyncDefault(t *testing.T) {
+	w, err := NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.cursorSync {
+		t.Fatal("默认应开启游标落盘")
+	}
+	off := false
+	cfg := FileWatcherConfig{CursorSync: &off}
+	opts, err := cfg.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, err = NewWatcher(opts...); err != nil || w.cursorSync {
+		t.Fatalf("配置关闭游标落盘未生效: %v", err)
+	}
+}
+
+func TestCursorBeyondTruncatedFile(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	var old, fresh strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&old, "old-%03d\n", i)
+	}
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&fresh, "new-%d\n", i)
+	}
+	if err := os.WriteFile(filePath, []byte(old.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	content, errs := drainFile(t, dir)
+	if len(errs) > 0 || content != old.String() {
+		t.Fatalf("首次读取: %d字节, 错误: %v", len(content), errs)
+	}
+	// 停止期间文件被截断后写入了较少的内容, 游标超过文件大小
+	if err := os.Truncate(filePath, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, []byte(fresh.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(WithDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	var got strings.Builder
+	truncated := false
+	go func() {
+		defer close(done)
+		for c := range w.ResChan {
+			truncated = truncated || c.Truncated
+			got.Write(c.Content)
+		}
+	}()
+	if err := w.DrainOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(w.ResChan)
+	<-done
+	if !truncated {
+		t.Error("未收到截断通知")
+	}
+	if got.String() != fresh.String() {
+		t.Fatalf("截断后应读取新写入的10行, 实际: %q", got.String())
+	}
+	c, err := w.cursors().Load(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Offset != int64(fresh.Len()) || c.Line != 10 {
+		t.Fatalf("游标应重写为新内容末尾, 实际: %+v", c)
+	}
+}
@@ -0,0 +1,81 @@
+package filewatch
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// isCompressed 根据扩展名判断是否为支持的压缩文件
+func isCompressed(filePath string) bool {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".gz", ".zst":
+		return true
+	}
+	return false
+}
+
+// newDecompressReader 根据扩展名创建对应的解压器, 返回的关闭函数用于释放解压器资源
+func newDecompressReader(filePath string, r io.Reader) (io.Reader, func(), error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".gz":
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gr, func() { gr.Close() }, nil
+	case ".zst":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr.Close, nil
+	}
+	return r, func() {}, nil
+}
+
+// skipDecompressedLines 丢弃解压后的前n行, 返回丢弃的字节数与行数, n小于0时丢弃全部内容.
+// 末尾没有换行符的内容同样计为一行, 与读取时一致; 内容不足n行时全部丢弃
+func skipDecompressedLines(r *bufio.Reader, n int64) (int64, int64, error) {
+	var skipped, lines int64
+	for n < 0 || lines < n {
+		chunk, err := r.ReadSlice('\n')
+		skipped += int64(len(chunk))
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF:
+			if len(chunk) > 0 {
+				lines++
+			}
+			return skipped, lines, nil
+		case err != nil:
+			return skipped, lines, err
+		}
+		lines++
+	}
+	return skipped, lines, nil
+}
+
+// skipDecompressed 丢弃解压后的前n个字节, 返回其中的行数. 解压后的内容不足n个字节时全部丢弃
+func skipDecompressed(r io.Reader, n int64) (int64, error) {
+	var lines lineCounter
+	_, err := io.CopyN(&lines, r, n)
+	if err == io.EOF {
+		err = nil
+	}
+	return int64(lines), err
+}
+
+// lineCounter 统计写入内容中的行数
+type lineCounter int64
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	*c += lineCounter(bytes.Count(p, []byte{'\n'}))
+	return len(p), nil
+}
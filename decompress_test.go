@@ -0,0 +1,144 @@
+package filewatch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// recordingStore 记录每次保存的游标
+type recordingStore struct {
+	*memoryCursorStore
+	saved []Cursor
+}
+
+func (s *recordingStore) Save(filePath string, c Cursor) error {
+	s.saved = append(s.saved, c)
+	return s.memoryCursorStore.Save(filePath, c)
+}
+
+func compressLines(t *testing.T, ext, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	switch ext {
+	case ".gz":
+		gw := gzip.NewWriter(&buf)
+		gw.Write([]byte(content))
+		gw.Close()
+	case ".zst":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw.Write([]byte(content))
+		zw.Close()
+	}
+	return buf.Bytes()
+}
+
+func TestCompressedResume(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 2500; i++ {
+		fmt.Fprintf(&b, "line-%05d\n", i)
+	}
+	content := b.String()
+	const lineLen = int64(len("line-00000\n"))
+	for _, ext := range []string{".gz", ".zst"} {
+		t.Run(ext, func(t *testing.T) {
+			dir := t.TempDir()
+			filePath := filepath.Join(dir, "a.log"+ext)
+			if err := os.WriteFile(filePath, compressLines(t, ext, content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			store := &recordingStore{memoryCursorStore: newMemoryCursorStore()}
+			got, errs := drainFile(t, dir, WithFileRegexp(`\.log\.(gz|zst)$`), WithDecompress(true),
+				WithCursorStore(store), WithCursorGranularity(CursorPerDelivery))
+			if len(errs) != 0 || got != content {
+				t.Fatalf("读取内容不完整: %d/%d, %v", len(got), len(content), errs)
+			}
+			// 每个游标都恰好位于已发送的行末尾
+			if len(store.saved) < 2 {
+				t.Fatalf("游标保存次数过少: %d", len(store.saved))
+			}
+			for _, c := range store.saved {
+				if c.Offset%lineLen != 0 || c.Line != c.Offset/lineLen {
+					t.Fatalf("游标不在行末尾: %+v", c)
+				}
+			}
+
+			// 从第一批内容之后继续读取, 不丢失也不重复
+			first := store.saved[0]
+			resumed := newMemoryCursorStore()
+			resumed.Save(filePath, first)
+			got, errs = drainFile(t, dir, WithFileRegexp(`\.log\.(gz|zst)$`), WithDecompress(true), WithCursorStore(resumed))
+			if len(errs) != 0 || got != content[first.Offset:] {
+				t.Fatalf("恢复读取的内容错误: 从%d开始, 读取%d字节, %v", first.Offset, len(got), errs)
+			}
+			if c, _ := resumed.Load(filePath); c.Offset != int64(len(content)) || c.Line != 2500 {
+				t.Fatalf("读取完毕后的游标错误: %+v", c)
+			}
+		})
+	}
+}
+
+func TestCompressedResumeByLines(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&b, "line-%05d\n", i)
+	}
+	content := b.String()
+	const lineLen = len("line-00000\n")
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log.gz")
+	if err := os.WriteFile(filePath, compressLines(t, ".gz", content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var identified Cursor
+	err = identified.identify(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, c := range map[string]Cursor{
+		// 按行数恢复, 偏移量不参与定位
+		"lines": {Offset: identified.Size, Line: 40, Dev: identified.Dev, Inode: identified.Inode,
+			HeadLen: identified.HeadLen, HeadHash: identified.HeadHash},
+		// 旧版本游标只记录了解压后的偏移量
+		"legacy offset": {Offset: int64(40 * lineLen)},
+	} {
+		store := newMemoryCursorStore()
+		store.Save(filePath, c)
+		got, errs := drainFile(t, dir, WithFileRegexp(`\.log\.gz$`), WithDecompress(true), WithCursorStore(store))
+		if len(errs) != 0 || got != content[40*lineLen:] {
+			t.Fatalf("%s: 恢复读取的内容错误: 读取%d字节, %v", name, len(got), errs)
+		}
+		if c, _ := store.Load(filePath); c.Offset != int64(len(content)) || c.Line != 100 {
+			t.Fatalf("%s: 读取完毕后的游标错误: %+v", name, c)
+		}
+	}
+
+	// 只读取新增内容时, 已有的压缩文件整体跳过
+	store := newMemoryCursorStore()
+	w, err := NewWatcher(WithDir(dir), WithDecompress(true), WithCursorStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.tailCursor(filePath); err != nil {
+		t.Fatal(err)
+	}
+	got, errs := drainFile(t, dir, WithFileRegexp(`\.log\.gz$`), WithDecompress(true), WithCursorStore(store))
+	if len(errs) != 0 || got != "" {
+		t.Fatalf("已跳过的压缩文件被重新读取: %q, %v", got, errs)
+	}
+}
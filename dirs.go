@@ -0,0 +1,174 @@
+package filewatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 等待文件夹出现时的检查间隔, 从dirPollInterval开始每次翻倍, 最长为dirPollMaxInterval,
+// 适用于容器中挂载卷异步就绪的场景
+const (
+	dirPollInterval    = time.Second
+	dirPollMaxInterval = 30 * time.Second
+)
+
+// AddDir 追加一个监控的文件夹, 运行期间调用时会立即开始监控并扫描一次该文件夹.
+// 与已有文件夹重复或嵌套时返回错误
+func (w *FileWatcher) AddDir(dirPath string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fsWatcher == nil {
+		return WithAddDir(dirPath)(w)
+	}
+
+	if err := checkDir(dirPath); err != nil {
+		return err
+	}
+	dirs, err := appendDir(w.watchDirs(), dirPath)
+	if err != nil {
+		return err
+	}
+	if err := w.addDirTree(w.fsWatcher, dirPath, dirPath); err != nil {
+		return err
+	}
+	w.dirPaths = dirs
+
+	ctx := w.filesCtx
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.scanDir(ctx, dirPath)
+	}()
+	w.info("已添加监控文件夹", slog.String("dir", dirPath))
+	return nil
+}
+
+// RemoveDir 移除一个监控的文件夹, 运行期间调用时会结束该文件夹下所有文件的监听,
+// 各文件会先发送剩余内容并保存游标. 不能移除最后一个文件夹
+func (w *FileWatcher) RemoveDir(dirPath string) error {
+	absDir, err := filepath.Abs(dirPath)
+	if err != nil {
+		return fmt.Errorf("获取文件夹(%s)绝对路径失败: %w", dirPath, err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dirs := w.watchDirs()
+	idx := -1
+	for i, dir := range dirs {
+		if abs, err := filepath.Abs(dir); err == nil && abs == absDir {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return fmt.Errorf("%w: %s", ErrDirNotWatched, dirPath)
+	}
+	if len(dirs) == 1 {
+		return fmt.Errorf("不能移除最后一个监控文件夹: %s", dirPath)
+	}
+	w.dirPaths = append(append([]string(nil), dirs[:idx]...), dirs[idx+1:]...)
+
+	if w.fsWatcher != nil {
+		for _, path := range w.fsWatcher.WatchList() {
+			if abs, err := filepath.Abs(path); err == nil && isSubDir(absDir, abs) {
+				w.fsWatcher.Remove(path)
+			}
+		}
+	}
+	w.cancelFilesUnder(dirPath)
+	w.info("已移除监控文件夹", slog.String("dir", dirPath))
+	return nil
+}
+
+// prepareDirs 启动前处理不存在的监控文件夹: 按配置创建, 或在超时时间内等待其出现
+func (w *FileWatcher) prepareDirs(ctx context.Context) error {
+	for _, dirPath := range w.currentDirs() {
+		if err := w.prepareDir(ctx, dirPath, w.waitForDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareDir 确保文件夹存在, timeout<=0时不等待
+func (w *FileWatcher) prepareDir(ctx context.Context, dirPath string, timeout time.Duration) error {
+	if _, err := os.Stat(dirPath); !errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if w.createDirPerm != 0 {
+		if err := os.MkdirAll(dirPath, w.createDirPerm); err != nil {
+			return fmt.Errorf("创建文件夹(%s)失败: %w", dirPath, err)
+		}
+		w.info("已创建监控文件夹", slog.String("dir", dirPath))
+		return nil
+	}
+	if timeout <= 0 {
+		return nil
+	}
+
+	w.warn("监控文件夹不存在, 等待其创建", slog.String("dir", dirPath))
+	interval := dirPollInterval
+	retry := time.NewTimer(interval)
+	defer retry.Stop()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("%w: 等待%v后仍不存在: %s", ErrDirNotExist, timeout, dirPath)
+		case <-retry.C:
+			if _, err := os.Stat(dirPath); err == nil {
+				return nil
+			}
+			interval = min(interval*2, dirPollMaxInterval)
+			retry.Reset(interval)
+		}
+	}
+}
+
+// rootDir 判断路径是否为某个监控的根文件夹
+func (w *FileWatcher) rootDir(path string) (string, bool) {
+	path = filepath.Clean(path)
+	for _, dirPath := range w.currentDirs() {
+		if filepath.Clean(dirPath) == path {
+			return dirPath, true
+		}
+	}
+	return "", false
+}
+
+// reattachDir 监控的根文件夹被删除后, 等待其重新出现(或按配置重新创建), 再重新添加到监控器并扫描.
+// files为开始文件监听时使用的ctx
+func (w *FileWatcher) reattachDir(ctx, files context.Context, dirPath string) {
+	w.warn("监控文件夹已被删除, 等待其重新创建", slog.String("dir", dirPath))
+	// 不限时等待, 直至监控任务结束
+	if err := w.prepareDir(ctx, dirPath, time.Duration(math.MaxInt64)); err != nil {
+		if ctx.Err() == nil {
+			w.handleErr(err)
+		}
+		return
+	}
+
+	w.mu.Lock()
+	watcher := w.fsWatcher
+	w.mu.Unlock()
+	if watcher == nil {
+		return
+	}
+	if err := w.addDirTree(watcher, dirPath, dirPath); err != nil {
+		w.errorf("重新添加文件夹(%s)到监控器时失败: %w", dirPath, err)
+		return
+	}
+	w.info("监控文件夹已重新添加", slog.String("dir", dirPath))
+	w.scanDir(files, dirPath)
+}
@@ -0,0 +1,122 @@
+package filewatch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startWatcher 启动监控任务, 测试结束时停止
+func startWatcher(t *testing.T, opts ...Option) *FileWatcher {
+	t.Helper()
+	w, err := NewWatcher(append([]Option{WithInMemoryCursors(), WithFlushInterval(50 * time.Millisecond)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready := make(chan error, 1)
+	go w.start(context.Background(), ready)
+	if err := <-ready; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Stop() })
+	return w
+}
+
+// receiveFiles 接收内容直到want中的文件均已收到, 返回各文件收到的内容; 等待wait后没有新内容时结束
+func receiveFiles(t *testing.T, w *FileWatcher, want []string, wait time.Duration) map[string]string {
+	t.Helper()
+	got := make(map[string]string)
+	missing := func() []string {
+		var res []string
+		for _, filePath := range want {
+			if _, ok := got[filePath]; !ok {
+				res = append(res, filePath)
+			}
+		}
+		return res
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		idle := time.After(wait)
+		select {
+		case c := <-w.ResChan:
+			got[c.FilePath] += string(c.Content)
+			continue
+		case <-idle:
+			if len(missing()) == 0 {
+				return got
+			}
+		case <-timeout:
+			t.Fatalf("未收到文件的内容: %v", missing())
+		}
+	}
+}
+
+func writeFiles(t *testing.T, files ...string) {
+	t.Helper()
+	for _, filePath := range files {
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(filepath.Base(filePath)+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNonRecursive(t *testing.T) {
+	dir := t.TempDir()
+	top, nested := filepath.Join(dir, "a.log"), filepath.Join(dir, "old", "a.log")
+	writeFiles(t, top, nested)
+	var mu sync.Mutex
+	started := make(map[string]bool)
+	w := startWatcher(t, WithDir(dir), WithRecursive(false), WithOnFileStart(func(filePath string) {
+		mu.Lock()
+		defer mu.Unlock()
+		started[filePath] = true
+	}))
+	// 启动后新建的文件与子文件夹
+	newTop, newNested := filepath.Join(dir, "b.log"), filepath.Join(dir, "new", "b.log")
+	writeFiles(t, newTop, newNested)
+	got := receiveFiles(t, w, []string{top, newTop}, 300*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	for _, filePath := range []string{nested, newNested} {
+		if _, ok := got[filePath]; ok || started[filePath] {
+			t.Errorf("非递归模式下不应监听子文件夹中的文件: %s", filePath)
+		}
+	}
+}
+
+func TestNestedDirBurst(t *testing.T) {
+	dir := t.TempDir()
+	// 启动时的扫描会读取已有的文件, 等收到启动前写入的文件后再创建文件夹, 确保由文件夹的创建事件发现文件
+	ready := filepath.Join(dir, "ready.log")
+	writeFiles(t, ready)
+	w := startWatcher(t, WithDir(dir))
+	receiveFiles(t, w, []string{ready}, 50*time.Millisecond)
+	// 在监控文件夹外建好3层文件夹及其中的文件后整体移入, 相当于mkdir -p后立即写入且快于事件处理,
+	// 子文件夹中的文件在添加到监控器之前就已存在
+	staging := t.TempDir()
+	var files []string
+	for i, sub := range []string{"2024", filepath.Join("2024", "06"), filepath.Join("2024", "06", "01")} {
+		for j := 0; j < 3; j++ {
+			name := fmt.Sprintf("job%d-%d.log", i, j)
+			writeFiles(t, filepath.Join(staging, sub, name))
+			files = append(files, filepath.Join(dir, sub, name))
+		}
+	}
+	if err := os.Rename(filepath.Join(staging, "2024"), filepath.Join(dir, "2024")); err != nil {
+		t.Fatal(err)
+	}
+	got := receiveFiles(t, w, files, 300*time.Millisecond)
+	for _, filePath := range files {
+		if want := filepath.Base(filePath) + "\n"; got[filePath] != want {
+			t.Errorf("%s: content = %q, want %q", filePath, got[filePath], want)
+		}
+	}
+}
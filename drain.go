@@ -0,0 +1,169 @@
+package filewatch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// DrainOnce 不启动fsnotify监控, 遍历一次监控文件夹, 将各匹配文件从游标处读取至末尾(或结束标记)后返回.
+// 内容发送至结果通道并保存游标, 调用方需同时消费结果通道; 读取到结束标记的文件按removeAfterComplete决定是否删除.
+// 无需调用Start, 监控任务运行中时返回ErrWatching, 已调用Stop(结果通道已关闭)时返回ErrStopped;
+// 正在被其他协程监听的文件会被跳过
+func (w *FileWatcher) DrainOnce(ctx context.Context) error {
+	if w.Watching() {
+		return ErrWatching
+	}
+	// 计入wg, Stop会等待读取结束后再关闭结果通道
+	w.wg.Add(1)
+	defer w.wg.Done()
+	w.enterRead()
+	defer w.leaveRead()
+	out, ok := w.sink()
+	if !ok {
+		return ErrStopped
+	}
+	parent := ctx
+	ctx, cancel := w.withStop(parent)
+	defer cancel()
+	var errs []error
+	for _, dirPath := range w.currentDirs() {
+		if err := checkDir(dirPath); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		w.walkFiles(ctx, dirPath, dirPath, func(path string) {
+			if err := w.drainFile(ctx, out, path); err != nil {
+				errs = append(errs, err)
+			}
+		})
+	}
+	if err := parent.Err(); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ErrStopped
+	}
+	return errors.Join(errs...)
+}
+
+// drainFile 将单个文件从游标处读取至末尾, 读取到结束标记时视配置删除文件及游标
+func (w *FileWatcher) drainFile(ctx context.Context, out resultSink, filePath string) (err error) {
+	if !w.claimFile(filePath) {
+		w.info("文件正在被监听, 跳过", slog.String("file", filePath))
+		return nil
+	}
+	defer w.releaseFile(filePath)
+	dirPath := w.dirOf(filePath)
+	w.fileStarted(dirPath, filePath)
+	defer w.fileStopped(dirPath, filePath)
+	defer func() {
+		if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, ErrStopped) {
+			w.fileErrored(dirPath, filePath)
+			err = fmt.Errorf("读取文件(%s)失败: %w", filePath, err)
+		}
+	}()
+	cfg := w.fileConfig(filePath)
+	// abort 内容未能发送时的错误
+	abort := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return ErrStopped
+	}
+
+	fr, err := w.openFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+	if fr.truncated && !out.send(ctx, FileContent{FilePath: filePath, Pattern: cfg.pattern, Profile: cfg.profile, Tags: cfg.tags, Truncated: true, Timestamp: time.Now()}) {
+		return abort()
+	}
+
+	offset := fr.offset
+	var batchLog, record bytes.Buffer
+	span := lineSpan{line: fr.line}
+	saver := w.newCursorSaver(filePath)
+	// final为true时发送缓冲区中的全部内容, 否则保留末尾不完整的UTF-8字符
+	send := func(eof, final bool) error {
+		status := StatusContinue
+		if eof {
+			status = StatusComplete
+		}
+		start, end := span.take()
+		if !out.send(ctx, w.packContent(FileContent{FilePath: filePath, Pattern: cfg.pattern, Profile: cfg.profile, Tags: cfg.tags, Content: flushSafeUTF8(&batchLog, final), EOF: eof, Status: status, Timestamp: time.Now(), LineStart: start, LineEnd: end})) {
+			return abort()
+		}
+		if final {
+			return saver.saveNow(fr, offset, span.line)
+		}
+		return saver.save(fr, offset, span.line)
+	}
+
+	const maxBatchCnt = 1000
+	var batchCnt int
+	scanner := w.newScanner(fr)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		offset = fr.position()
+		w.lineRead(dirPath, filePath, len(line)+1)
+		span.line++
+
+		line, eof, keep := w.processLine(line, cfg)
+		if !keep {
+			continue
+		}
+		span.keep()
+		if w.recordDelimiter != nil {
+			record.Write(line)
+			record.WriteByte('\n')
+			if !eof && !w.recordDelimiter(line) {
+				continue
+			}
+			// 完整的记录单独发送, 未完成的记录随结束标记一起发送
+			batchLog.Write(record.Bytes())
+			record.Reset()
+			if err = send(eof, eof); err != nil {
+				return err
+			}
+		} else {
+			batchCnt++
+			batchLog.Write(line)
+			batchLog.WriteByte('\n')
+			tooLarge := w.maxBatchBytes > 0 && int64(batchLog.Len()) >= w.maxBatchBytes
+			if eof || batchCnt >= maxBatchCnt || tooLarge {
+				if err = send(eof, eof); err != nil {
+					return err
+				}
+				batchCnt = 0
+			}
+		}
+		if eof {
+			w.fileCompleted(dirPath, filePath)
+			if !cfg.removeAfterComplete {
+				return nil
+			}
+			if err = os.Remove(filePath); err != nil {
+				return fmt.Errorf("删除log文件失败: %w", err)
+			}
+			if err = w.cursors().Delete(filePath); err != nil {
+				return fmt.Errorf("删除游标失败: %w", err)
+			}
+			return nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	// 未读取到结束标记, 发送剩余内容(包括未完成的多行记录)并保存游标, 下次从此处继续
+	batchLog.Write(record.Bytes())
+	if batchLog.Len() > 0 {
+		return send(false, true)
+	}
+	return saver.saveNow(fr, offset, span.line)
+}
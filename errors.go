@@ -0,0 +1,109 @@
+package filewatch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"syscall"
+)
+
+var (
+	ErrInvalidRegexp          = errors.New("文件名正则表达式不合法")
+	ErrDirNotExist            = errors.New("监控文件夹不存在")
+	ErrOverlappingDir         = errors.New("监控文件夹重复或嵌套")
+	ErrDirNotWatched          = errors.New("文件夹未被监控")
+	ErrNotDir                 = errors.New("监控路径不是文件夹")
+	ErrInvalidMaxNoUpdateTime = errors.New("文件最大未更新时间必须大于0")
+	ErrNotRegularFile         = errors.New("监控路径不是普通文件")
+	ErrAlreadyWatching        = errors.New("文件夹正在被监控中")
+	ErrWatching               = errors.New("监控任务运行中, 无法修改配置")
+	ErrBadCursor              = errors.New("游标文件已损坏")
+	ErrFileWatching           = errors.New("文件已在监听中")
+	ErrStopTimeout            = errors.New("等待监控协程退出超时")
+	ErrStopped                = errors.New("监控任务已停止")
+	ErrNotReconfigurable      = errors.New("该配置项在运行中无法修改")
+	ErrFileTooLarge           = errors.New("文件超过大小限制")
+	ErrBinaryFile             = errors.New("文件内容为二进制, 已跳过")
+	ErrInvalidGlob            = errors.New("文件名glob模式不合法")
+	ErrGlobAndRegexp          = errors.New("glob模式与正则表达式不能同时设置")
+	ErrPatternConflict        = errors.New("添加的文件名表达式不能与glob模式或正则表达式同时设置")
+	ErrResChanSizeFixed       = errors.New("结果通道的缓冲大小只能在NewWatcher时设置")
+)
+
+// PermissionError 无权限读取文件(如EACCES), 可通过errors.As判断, 与其他IO错误分开处理.
+// 监听时遇到该错误的文件会被跳过, 错误通过错误处理函数上报
+type PermissionError struct {
+	Path string
+	Err  error // 底层的*fs.PathError
+}
+
+func (e PermissionError) Error() string {
+	return fmt.Sprintf("无权限读取文件(%s): %v", e.Path, e.Err)
+}
+
+func (e PermissionError) Unwrap() error {
+	return e.Err
+}
+
+// wrapPermission 权限不足的错误包装为PermissionError, 其他错误原样返回
+func wrapPermission(filePath string, err error) error {
+	if errors.Is(err, fs.ErrPermission) {
+		return PermissionError{Path: filePath, Err: err}
+	}
+	return err
+}
+
+// WatchLimitError 超出系统对文件监控数量的限制, 可通过errors.As判断.
+// Linux下由inotify的内核参数限制: 监控的文件夹、文件总数(max_user_watches)及监控器数量(max_user_instances),
+// 需调高对应的内核参数或减少监控的文件夹后重试
+type WatchLimitError struct {
+	Path  string // 添加监控失败的路径, 创建监控器失败时为空
+	Limit string // 需调高的内核参数, 如fs.inotify.max_user_watches
+	Err   error  // fsnotify返回的错误
+}
+
+func (e WatchLimitError) Error() string {
+	hint := fmt.Sprintf("请调高/proc/sys/%s(如sysctl -w %s=%s)", strings.ReplaceAll(e.Limit, ".", "/"), e.Limit, watchLimitSuggestion[e.Limit])
+	if e.Limit == inotifyMaxInstances {
+		hint += "或进程的打开文件数限制(ulimit -n)"
+	}
+	if e.Path == "" {
+		return fmt.Sprintf("创建监控器失败, 已超出系统的监控数量限制: %v; %s", e.Err, hint)
+	}
+	return fmt.Sprintf("添加监控(%s)失败, 已超出系统的监控数量限制: %v; %s", e.Path, e.Err, hint)
+}
+
+func (e WatchLimitError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	inotifyMaxWatches   = "fs.inotify.max_user_watches"
+	inotifyMaxInstances = "fs.inotify.max_user_instances"
+)
+
+// watchLimitSuggestion 提示中建议设置的内核参数值
+var watchLimitSuggestion = map[string]string{
+	inotifyMaxWatches:   "524288",
+	inotifyMaxInstances: "1024",
+}
+
+// wrapWatchLimit 超出监控数量限制的错误(ENOSPC、EMFILE)包装为WatchLimitError, 其他错误原样返回
+func wrapWatchLimit(path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	// fsnotify在部分平台上只返回错误信息, 同时按错误信息判断
+	msg := err.Error()
+	var limit string
+	switch {
+	case errors.Is(err, syscall.ENOSPC) || strings.Contains(msg, "no space left on device"):
+		limit = inotifyMaxWatches
+	case errors.Is(err, syscall.EMFILE) || strings.Contains(msg, "too many open files"):
+		limit = inotifyMaxInstances
+	default:
+		return err
+	}
+	return WatchLimitError{Path: path, Limit: limit, Err: err}
+}
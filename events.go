@@ -0,0 +1,133 @@
+package filewatch
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileEvents 各文件监听协程共用的fsnotify监控器, 避免每个文件占用一个inotify实例.
+// 第一个文件订阅时创建, 最后一个文件取消订阅时关闭
+type fileEvents struct {
+	mu      sync.Mutex
+	watcher *fsnotify.Watcher
+	refs    int
+	subs    map[string][]*fileSubscriber // 文件路径 -> 订阅; 多个符号链接指向同一文件时路径相同, 事件分发给每个订阅
+}
+
+// fileSubscriber 单个文件的事件订阅
+type fileSubscriber struct {
+	events chan fsnotify.Event // 缓冲已满时与最早的事件合并, 分发不会被处理缓慢的订阅阻塞
+	errs   chan error
+}
+
+// deliver 不阻塞地发送事件. 缓冲已满时取出最早的事件, 将其Op合并到新事件后再发送:
+// 订阅者只关心发生过哪些操作, 合并不会丢失Write、Remove等信息
+func (s *fileSubscriber) deliver(event fsnotify.Event) {
+	for {
+		select {
+		case s.events <- event:
+			return
+		default:
+		}
+		select {
+		case old := <-s.events:
+			event.Op |= old.Op
+		default:
+		}
+	}
+}
+
+// subscribe 订阅文件的事件, filePath需与事件中的文件名一致(已解析符号链接的路径), 同一路径可有多个订阅
+func (e *fileEvents) subscribe(filePath string) (*fileSubscriber, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.watcher == nil {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, wrapWatchLimit("", err)
+		}
+		e.watcher = watcher
+		e.subs = make(map[string][]*fileSubscriber)
+		go e.dispatch(watcher)
+	}
+	sub := &fileSubscriber{
+		events: make(chan fsnotify.Event, 16),
+		errs:   make(chan error, 1),
+	}
+	e.subs[filePath] = append(e.subs[filePath], sub)
+	e.refs++
+	if err := e.watcher.Add(filePath); err != nil {
+		e.release(filePath, sub)
+		return nil, wrapWatchLimit(filePath, err)
+	}
+	return sub, nil
+}
+
+// unsubscribe 取消订阅文件的事件
+func (e *fileEvents) unsubscribe(filePath string, sub *fileSubscriber) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.release(filePath, sub)
+	// 同一路径还有其他订阅(指向同一文件的其他符号链接, 或轮转后新文件的订阅)时不能移除监控;
+	// 文件被删除后监控已自动移除, 忽略错误
+	if e.watcher != nil && len(e.subs[filePath]) == 0 {
+		e.watcher.Remove(filePath)
+	}
+}
+
+// release 移除订阅, 没有订阅时关闭监控器, 需持有mu
+func (e *fileEvents) release(filePath string, sub *fileSubscriber) {
+	subs := slices.DeleteFunc(e.subs[filePath], func(s *fileSubscriber) bool { return s == sub })
+	if len(subs) == 0 {
+		delete(e.subs, filePath)
+	} else {
+		e.subs[filePath] = subs
+	}
+	e.refs--
+	if e.refs == 0 {
+		e.watcher.Close()
+		e.watcher = nil
+		e.subs = nil
+	}
+}
+
+// dispatch 将事件分发给对应文件的所有订阅, 错误分发给所有订阅, 监控器关闭后退出
+func (e *fileEvents) dispatch(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			for _, sub := range e.subscribers(event.Name) {
+				sub.deliver(event)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			for _, sub := range e.subscribers("") {
+				select {
+				case sub.errs <- err:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// subscribers 获取文件的订阅, filePath为空时获取全部订阅; 返回副本, 发送时无需持有mu
+func (e *fileEvents) subscribers(filePath string) []*fileSubscriber {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if filePath != "" {
+		return slices.Clone(e.subs[filePath])
+	}
+	var all []*fileSubscriber
+	for _, subs := range e.subs {
+		all = append(all, subs...)
+	}
+	return all
+}
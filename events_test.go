@@ -0,0 +1,67 @@
+package filewatch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestSlowSubscriberDoesNotBlockDispatch(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "a.log")
+	if err := os.WriteFile(filePath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var e fileEvents
+	slow, err := e.subscribe(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.unsubscribe(filePath, slow)
+	fast, err := e.subscribe(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.unsubscribe(filePath, fast)
+
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// slow不读取事件, 写入次数远超其缓冲大小, fast仍能及时收到每次写入
+	for i := 0; i < 4*cap(slow.events); i++ {
+		if _, err := f.WriteString("l\n"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-fast.events:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("第%d次写入的事件未分发, 被未读取的订阅阻塞", i)
+		}
+	}
+	// 文件仍被打开时删除不会产生Remove事件
+	f.Close()
+	if err := os.Remove(filePath); err != nil {
+		t.Fatal(err)
+	}
+	for removed := false; !removed; {
+		select {
+		case event := <-fast.events:
+			removed = event.Has(fsnotify.Remove)
+		case <-time.After(2 * time.Second):
+			t.Fatal("删除事件未分发")
+		}
+	}
+
+	// 缓冲已满时事件被合并, 删除事件不会丢失
+	var op fsnotify.Op
+	for len(slow.events) > 0 {
+		op |= (<-slow.events).Op
+	}
+	if !op.Has(fsnotify.Write) || !op.Has(fsnotify.Remove) {
+		t.Errorf("合并后的事件 = %v, 应包含Write与Remove", op)
+	}
+}
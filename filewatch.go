@@ -1,26 +1,41 @@
+// Package filewatch 监控文件夹中的日志文件, 按行读取新增内容并发送至结果通道, 通过游标文件记录读取位置.
+//
+// 单行内容最长为DefaultMaxLineBytes(1MB), 可通过WithMaxLineBytes调整; 超过时该文件停止读取并上报bufio.ErrTooLong.
 package filewatch
 
 import (
-	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/fsnotify/fsnotify"
 )
 
 const (
-	DefaultDirPath         = "./logs"       // 需要被监控的文件夹
-	DefaultFileRegexp      = `.+.log`       // 需要被监控的文件名正则表达式
-	DefaultCompleteMarker  = "LOG_COMPLETE" // 文件监控结束标志符
-	DefaultMaxNoUpdateTime = 4 * time.Hour  // 文件最大未更新时长
+	DefaultDirPath         = "./logs"        // 需要被监控的文件夹
+	DefaultFileRegexp      = `.+.log`        // 需要被监控的文件名正则表达式
+	DefaultCompleteMarker  = "LOG_COMPLETE"  // 文件监控结束标志符
+	DefaultMaxNoUpdateTime = 4 * time.Hour   // 文件最大未更新时长
+	DefaultRotationGrace   = 5 * time.Second // 开启轮转支持时等待新文件出现的时长
+	DefaultMaxLineBytes    = 1024 * 1024     // 单行内容的最大长度
+	DefaultFlushInterval   = 2 * time.Second // 未凑满一批时发送已读取内容的最长间隔
+	stopFlushWait          = time.Second     // 停止时等待消费者接收剩余内容的最长时间
 )
 
 const (
@@ -28,144 +43,987 @@ const (
 )
 
 type FileContent struct {
-	FilePath string
-	Content  []byte
-	EOF      bool
+	FilePath  string
+	Content   []byte
+	EOF       bool              // 是否读取到结束标记, 等同于Status为StatusComplete
+	Status    ContentStatus     // 文件的监听状态, 非StatusContinue时表示该文件不再有后续内容
+	Timestamp time.Time         // 内容发送的时间
+	Rotated   bool              // 文件发生了轮转, 之后的内容来自同名的新文件
+	Truncated bool              // 开始读取时发现文件已被截断(游标超过文件大小), 游标已重置, 之后的内容从重置处读取
+	Pattern   string            // 文件匹配的表达式(通过AddFilePattern或AddProfile添加), 未添加时为空
+	Profile   string            // 文件使用的Profile名称, 使用全局配置时为空
+	Tags      map[string]string // 文件使用的Profile的标签, 只读
+	LineStart int64             // 内容首行在文件中的行号(从1开始), 被过滤的行同样计数; 没有内容时为0
+	LineEnd   int64             // 内容末行在文件中的行号
+	// Content是否经过gzip压缩(见WithCompressContent), 为true时需先调用Decompress获取原始内容,
+	// Reader、Lines及MarshalJSON均针对未解压的Content
+	Compressed bool
+
+	ack *ackEntry // 确认模式下用于Ack、Nack
 }
 
 func (f FileContent) String() string {
-	return fmt.Sprintf("filePath: %v, Content: %s, EOF: %v", f.FilePath, f.Content, f.EOF)
+	return fmt.Sprintf("filePath: %v, Lines: %d-%d, Content: %s, EOF: %v, Status: %v, Rotated: %v, Truncated: %v", f.FilePath, f.LineStart, f.LineEnd, f.Content, f.EOF, f.Status, f.Rotated, f.Truncated)
 }
 
-type FileWatcher struct {
-	dirPath             string
-	fileRegexp          string
+// Reader 返回读取Content的io.Reader, 不复制内容, 便于直接交给json.Decoder、csv.Reader等
+func (f FileContent) Reader() io.Reader {
+	return bytes.NewReader(f.Content)
+}
+
+// Lines 按换行符拆分Content, 去除末尾的空行
+func (f FileContent) Lines() []string {
+	lines := strings.Split(string(f.Content), "\n")
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Decompress 返回解压后的内容, 未压缩时直接返回Content
+func (f FileContent) Decompress() ([]byte, error) {
+	if !f.Compressed {
+		return f.Content, nil
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(f.Content))
+	if err != nil {
+		return nil, fmt.Errorf("解压内容失败: %w", err)
+	}
+	defer gr.Close()
+	content, err := io.ReadAll(gr)
+	if err != nil {
+		return nil, fmt.Errorf("解压内容失败: %w", err)
+	}
+	return content, nil
+}
+
+// MarshalJSON 序列化为JSON, 便于转发至日志收集系统.
+// Content为合法UTF-8时以原文输出, 否则以base64输出并将encoding标记为base64
+func (f FileContent) MarshalJSON() ([]byte, error) {
+	content, encoding := string(f.Content), ""
+	if !utf8.Valid(f.Content) {
+		content, encoding = base64.StdEncoding.EncodeToString(f.Content), "base64"
+	}
+	return json.Marshal(struct {
+		FilePath   string            `json:"file_path"`
+		Content    string            `json:"content"`
+		Encoding   string            `json:"encoding,omitempty"`
+		EOF        bool              `json:"eof"`
+		Status     string            `json:"status"`
+		Rotated    bool              `json:"rotated,omitempty"`
+		Truncated  bool              `json:"truncated,omitempty"`
+		Compressed bool              `json:"compressed,omitempty"`
+		Pattern    string            `json:"pattern,omitempty"`
+		Profile    string            `json:"profile,omitempty"`
+		Tags       map[string]string `json:"tags,omitempty"`
+		LineStart  int64             `json:"line_start,omitempty"`
+		LineEnd    int64             `json:"line_end,omitempty"`
+		Timestamp  time.Time         `json:"timestamp"`
+	}{f.FilePath, content, encoding, f.EOF, f.Status.String(), f.Rotated, f.Truncated, f.Compressed, f.Pattern, f.Profile, f.Tags, f.LineStart, f.LineEnd, f.Timestamp})
+}
+
+// ContentStatus 发送内容时文件的监听状态
+type ContentStatus int
+
+const (
+	StatusContinue         ContentStatus = iota // 文件仍在监听中, 后续可能还有内容
+	StatusComplete                              // 读取到结束标记
+	StatusTimeout                               // 长时间未更新, 不再监听
+	StatusRemoved                               // 文件被删除
+	StatusError                                 // 监听出错
+	StatusTooLarge                              // 文件在监听期间超过大小限制, 不再读取
+	StatusDeadlineExceeded                      // 到达WatchUntil指定的截止时间, 不再监听
+
+	// statusReplaced 仅在内部使用, 文件路径已指向另一个文件(如被删除后重新创建、被其他文件覆盖), 不会发送给调用方
+	statusReplaced ContentStatus = -1
+)
+
+func (s ContentStatus) String() string {
+	switch s {
+	case StatusContinue:
+		return "continue"
+	case StatusComplete:
+		return "complete"
+	case StatusTimeout:
+		return "timeout"
+	case StatusRemoved:
+		return "removed"
+	case StatusError:
+		return "error"
+	case StatusTooLarge:
+		return "too_large"
+	case StatusDeadlineExceeded:
+		return "deadline_exceeded"
+	}
+	return fmt.Sprintf("ContentStatus(%d)", int(s))
+}
+
+// settings 可通过Option设置的配置项
+type settings struct {
+	dirPaths            []string
+	fileRegexp          string // 为空时表示未设置, 使用默认表达式
+	fileGlob            string
+	matchBaseName       bool
+	caseInsensitive     bool
+	fileRe              *regexp.Regexp
+	filePatterns        []filePattern
+	excludeFileRegexp   string
+	excludeFileRe       *regexp.Regexp
 	completeMarker      string
-	watching            int64
+	completeMarkerRe    *regexp.Regexp
 	removeAfterComplete bool
 	maxNoUpdateTime     time.Duration
-	ResChan             chan FileContent
+	resChanSize         int
+	stopTimeout         time.Duration
+	rescanInterval      time.Duration
+	pollingInterval     time.Duration
+	maxConcurrentFiles  int
+	createDirPerm       os.FileMode
+	waitForDir          time.Duration
+	maxBatchBytes       int64
+	flushInterval       time.Duration
+	compressContent     bool
+	subscribePolicy     SubscribePolicy
+	maxFileSize         int64
+	maxLineBytes        int
+	truncateToEnd       bool
+	tailOversize        bool
+	skipBinary          bool
+	deferEmpty          bool
+	tailExisting        bool
+	minFileAge          time.Duration
+	rotationGrace       time.Duration
+	cursorDir           string
+	cursorSync          bool
+	cursorSaveInterval  time.Duration
+	cursorGranularity   CursorGranularity
+	ackMode             bool
+	ackTimeout          time.Duration
+	refuseBadCursor     bool
+	decompress          bool
+	followSymlinks      bool
+	recursive           bool
+	recordDelimiter     func(line []byte) bool
+	maxDepth            int
+	excludeDirRe        *regexp.Regexp
+	ignoreHidden        bool
+	lineFilter          func(line []byte) bool
+	lineTransformer     func(line []byte) []byte
+	errorHandler        func(error)
+	onFileStart         func(filePath string)
+	onFileComplete      func(filePath string, err error)
+	logHandler          func(string)
+	logger              *slog.Logger
+	statsObserver       StatsObserver
+	cursorStore         CursorStore
+}
+
+type FileWatcher struct {
+	settings
+	watching int64
+	ResChan  chan FileContent
+
+	mu       sync.Mutex
+	stopped  bool
+	stopChan chan struct{} // 关闭时通知所有监控协程退出
+	stopDone chan struct{} // 上一次停止的协程全部退出(Stop时还需关闭结果通道)后关闭
+	closing  bool          // 已调用Stop, 结果通道已关闭或将在协程退出后关闭
+	readers  int           // 正在读取配置的Watch与DrainOnce数量, 不为0时拒绝修改配置
+	paused   bool
+	resumeCh chan struct{}  // 暂停期间有效, Resume时关闭以唤醒各监控协程
+	wg       sync.WaitGroup // 跟踪Start、Scan以及各文件的Watch协程
+
+	fsWatcher *fsnotify.Watcher // 运行中的监控器, 未运行时为nil
+	filesCtx  context.Context   // 运行中的监控任务开始文件监听时使用的ctx
+	events    fileEvents        // 各文件共用的监控器
+
+	subscribers contentSubscribers // 通过Subscribe订阅结果通道的订阅者
+
+	emptyFiles sync.Map // 延迟监听的空文件, 以清理后的绝对路径为key
+
+	filesMu     sync.Mutex
+	files       map[string]*watchedFile // 正在监听的文件, 以fileKey为key
+	activeFiles sync.Map                // 已有协程在读取的文件, 以清理后的绝对路径为key
+
+	poolMu  sync.Mutex
+	running int           // 受并发限制时正在监听的文件数
+	pending []pendingFile // 等待空闲名额的文件
+
+	stats Stats // 统计信息, 需通过原子操作读写
 }
 
 // SetWatchDir 设置监控的文件夹
-func (w *FileWatcher) SetWatchDir(dirPath string) {
-	w.dirPath = dirPath
+func (w *FileWatcher) SetWatchDir(dirPath string) error {
+	return w.configure(WithDir(dirPath))
+}
+
+// SetWatchDirs 设置监控的多个文件夹, 所有文件夹的内容均发送至同一个结果通道
+func (w *FileWatcher) SetWatchDirs(dirs []string) error {
+	return w.configure(WithDirs(dirs...))
+}
+
+// AddWatchDir 追加一个监控的文件夹, 可多次调用, 与已有文件夹重复或嵌套时返回错误
+func (w *FileWatcher) AddWatchDir(dirPath string) error {
+	return w.configure(WithAddDir(dirPath))
+}
+
+// watchDirs 获取监控的文件夹, 未设置时使用默认文件夹
+func (w *FileWatcher) watchDirs() []string {
+	if len(w.dirPaths) == 0 {
+		return []string{DefaultDirPath}
+	}
+	return w.dirPaths
+}
+
+// currentDirs 加锁获取监控的文件夹副本, 用于运行期间读取
+func (w *FileWatcher) currentDirs() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.watchDirs()...)
+}
+
+// SetFileRegexp 设置监控的文件名正则表达式, 为空时使用默认表达式
+func (w *FileWatcher) SetFileRegexp(regexp string) error {
+	return w.configure(WithFileRegexp(regexp))
+}
+
+// SetExcludeFileRegexp 设置排除的文件名正则表达式, 为空时不排除
+func (w *FileWatcher) SetExcludeFileRegexp(expr string) error {
+	return w.configure(WithExcludeFileRegexp(expr))
+}
+
+// SetExcludeFileRegexps 设置一组排除的文件名正则表达式, 文件匹配任意一个即被排除, 见WithExcludeFileRegexps
+func (w *FileWatcher) SetExcludeFileRegexps(exprs []string) error {
+	return w.configure(WithExcludeFileRegexps(exprs...))
+}
+
+// SetExcludeRegexp 同SetExcludeFileRegexp
+func (w *FileWatcher) SetExcludeRegexp(expr string) error {
+	return w.SetExcludeFileRegexp(expr)
+}
+
+// SetExcludeRegexps 同SetExcludeFileRegexps
+func (w *FileWatcher) SetExcludeRegexps(exprs []string) error {
+	return w.SetExcludeFileRegexps(exprs)
+}
+
+// SetCaseInsensitiveMatch 设置文件名正则表达式与glob模式是否忽略大小写
+func (w *FileWatcher) SetCaseInsensitiveMatch(fold bool) error {
+	return w.configure(WithCaseInsensitiveMatch(fold))
+}
+
+// SetMatchBaseName 设置文件名正则表达式是否只匹配文件名, 默认匹配完整路径
+func (w *FileWatcher) SetMatchBaseName(base bool) error {
+	return w.configure(WithMatchBaseName(base))
+}
+
+// SetExcludeDirRegexp 设置排除的文件夹正则表达式, 匹配相对于监控文件夹的路径, 为空时不排除
+func (w *FileWatcher) SetExcludeDirRegexp(expr string) error {
+	return w.configure(WithExcludeDirRegexp(expr))
+}
+
+// SetIgnoreHidden 设置是否忽略以.开头的隐藏文件及文件夹, 默认为true; 监控文件夹本身不受影响
+func (w *FileWatcher) SetIgnoreHidden(ignore bool) error {
+	return w.configure(WithIgnoreHidden(ignore))
 }
 
-// SetFileRegexp 设置监控的文件名正则表达式
-func (w *FileWatcher) SetFileRegexp(regexp string) {
-	w.fileRegexp = regexp
+// SetFileGlob 以glob模式代替正则表达式选择监控的文件, 支持**, 不能与正则表达式同时设置
+func (w *FileWatcher) SetFileGlob(pattern string) error {
+	return w.configure(WithFileGlob(pattern))
 }
 
 // SetCompleteMarker 设置文件的结束标记
-func (w *FileWatcher) SetCompleteMarker(marker string) {
-	w.completeMarker = marker
+func (w *FileWatcher) SetCompleteMarker(marker string) error {
+	return w.configure(WithCompleteMarker(marker))
+}
+
+// SetCompleteMarkerRegexp 设置文件结束标记的正则表达式, 与字符串结束标记同时生效, 为nil时只使用字符串
+func (w *FileWatcher) SetCompleteMarkerRegexp(re *regexp.Regexp) error {
+	return w.configure(WithCompleteMarkerRegexp(re))
 }
 
 // SetRemoveAfterComplete 设置监控完毕后是否删除该文件
-func (w *FileWatcher) SetRemoveAfterComplete(remove bool) {
-	w.removeAfterComplete = remove
+func (w *FileWatcher) SetRemoveAfterComplete(remove bool) error {
+	return w.configure(WithRemoveAfterComplete(remove))
 }
 
 // SetMaxNoUpdateTime 设置文件最大未更新时间, 用来结束监控协程
-func (w *FileWatcher) SetMaxNoUpdateTime(dur time.Duration) {
-	w.maxNoUpdateTime = dur
+func (w *FileWatcher) SetMaxNoUpdateTime(dur time.Duration) error {
+	return w.configure(WithMaxNoUpdateTime(dur))
+}
+
+// SetResChanSize 设置结果通道的缓冲大小, 结果通道已在NewWatcher时创建, 大小不同时返回ErrResChanSizeFixed,
+// 请改用WithResChanBuffer
+func (w *FileWatcher) SetResChanSize(size int) error {
+	return w.configure(WithResChanBuffer(size))
+}
+
+// SetStopTimeout 设置Stop等待监控协程退出的超时时间, 0表示一直等待
+func (w *FileWatcher) SetStopTimeout(dur time.Duration) error {
+	return w.configure(WithStopTimeout(dur))
+}
+
+// SetMaxBatchBytes 设置单批次内容的最大字节数, 超过后立即发送, 0表示不限制
+func (w *FileWatcher) SetMaxBatchBytes(size int64) error {
+	return w.configure(WithMaxBatchBytes(size))
+}
+
+// SetFlushInterval 设置未凑满一批时发送已读取内容的最长间隔, 0表示使用默认值DefaultFlushInterval
+func (w *FileWatcher) SetFlushInterval(d time.Duration) error {
+	return w.configure(WithFlushInterval(d))
+}
+
+// SetCompressContent 设置是否以gzip压缩发送的内容, 见WithCompressContent
+func (w *FileWatcher) SetCompressContent(compress bool) error {
+	return w.configure(WithCompressContent(compress))
+}
+
+// SetMaxFileSize 设置可监听的最大文件大小(字节), 超过时不读取并通过错误处理函数告警, 0表示不限制
+func (w *FileWatcher) SetMaxFileSize(size int64) error {
+	return w.configure(WithMaxFileSize(size))
+}
+
+// SetMaxLineBytes 设置单行内容的最大长度, 0表示使用默认值DefaultMaxLineBytes
+func (w *FileWatcher) SetMaxLineBytes(n int) error {
+	return w.configure(WithMaxLineBytes(n))
+}
+
+// SetTruncateToEnd 设置发现文件被截断时是否从截断后的末尾开始读取, 默认从头读取
+func (w *FileWatcher) SetTruncateToEnd(toEnd bool) error {
+	return w.configure(WithTruncateToEnd(toEnd))
+}
+
+// SetTailOversize 设置超过大小限制的文件是否跳至末尾只读取新增内容, 默认跳过整个文件
+func (w *FileWatcher) SetTailOversize(tail bool) error {
+	return w.configure(WithTailOversize(tail))
+}
+
+// SetSkipBinary 设置是否跳过内容为二进制的文件
+func (w *FileWatcher) SetSkipBinary(skip bool) error {
+	return w.configure(WithSkipBinary(skip))
+}
+
+// SetDeferEmptyFiles 设置扫描时发现的空文件是否待写入后再开始监听
+func (w *FileWatcher) SetDeferEmptyFiles(deferEmpty bool) error {
+	return w.configure(WithDeferEmptyFiles(deferEmpty))
+}
+
+// SetCursorStore 设置游标的存储方式, 为nil时使用默认的游标文件
+func (w *FileWatcher) SetCursorStore(store CursorStore) error {
+	return w.configure(WithCursorStore(store))
+}
+
+// SetInMemoryCursors 游标只保存在内存中, 不创建游标文件, 进程重启后游标丢失
+func (w *FileWatcher) SetInMemoryCursors() error {
+	return w.configure(WithInMemoryCursors())
+}
+
+// SetCursorSaveInterval 设置游标的最小保存间隔, 0表示每次发送后都保存, 见WithCursorSaveInterval
+func (w *FileWatcher) SetCursorSaveInterval(d time.Duration) error {
+	return w.configure(WithCursorSaveInterval(d))
+}
+
+// SetCursorGranularity 设置游标的保存粒度, 见WithCursorGranularity
+func (w *FileWatcher) SetCursorGranularity(g CursorGranularity) error {
+	return w.configure(WithCursorGranularity(g))
+}
+
+// SetAckMode 设置是否开启确认模式, 见WithAckMode
+func (w *FileWatcher) SetAckMode(enable bool) error {
+	return w.configure(WithAckMode(enable))
+}
+
+// SetAckTimeout 设置确认模式下内容的确认超时, 见WithAckTimeout
+func (w *FileWatcher) SetAckTimeout(d time.Duration) error {
+	return w.configure(WithAckTimeout(d))
+}
+
+// SetCursorSync 设置保存游标文件时是否落盘, 默认开启, 见WithCursorSync
+func (w *FileWatcher) SetCursorSync(sync bool) error {
+	return w.configure(WithCursorSync(sync))
+}
+
+// SetCursorDir 设置游标文件的存放目录, 游标文件以被监听文件绝对路径的SHA-256命名, 为空时存放在被监听文件旁
+func (w *FileWatcher) SetCursorDir(dirPath string) error {
+	return w.configure(WithCursorDir(dirPath))
+}
+
+// SetRotationGrace 设置文件被删除或重命名后等待同名新文件出现的时长, 出现时从头继续读取, 0表示不支持轮转
+func (w *FileWatcher) SetRotationGrace(grace time.Duration) error {
+	return w.configure(WithRotationGrace(grace))
+}
+
+// SetMinFileAge 设置新建的文件开始监听前需满足的最小年龄(距最后修改的时长), 0表示立即开始
+func (w *FileWatcher) SetMinFileAge(d time.Duration) error {
+	return w.configure(WithMinFileAge(d))
+}
+
+// SetTailExisting 设置启动时已有的文件是否只读取新增的内容, 已有游标的文件仍从游标处继续读取
+func (w *FileWatcher) SetTailExisting(tail bool) error {
+	return w.configure(WithTailExisting(tail))
+}
+
+// SetRefuseBadCursor 设置游标文件损坏时是否拒绝监控该文件, 默认从头读取
+func (w *FileWatcher) SetRefuseBadCursor(refuse bool) error {
+	return w.configure(WithRefuseBadCursor(refuse))
+}
+
+// Watching 监控任务是否正在运行, 运行期间Set系列方法返回ErrWatching
+func (w *FileWatcher) Watching() bool {
+	return atomic.LoadInt64(&w.watching) == 1
+}
+
+// SetOnFileStart 设置文件开始监听时的回调函数
+func (w *FileWatcher) SetOnFileStart(hook func(filePath string)) error {
+	return w.configure(WithOnFileStart(hook))
+}
+
+// SetOnFileComplete 设置文件读取完毕(遇到结束标志符或长时间未更新)或因错误退出时的回调函数
+func (w *FileWatcher) SetOnFileComplete(hook func(filePath string, err error)) error {
+	return w.configure(WithOnFileComplete(hook))
+}
+
+// SetErrorHandler 设置错误处理函数, 为nil时以Error级别输出日志
+func (w *FileWatcher) SetErrorHandler(handler func(error)) error {
+	return w.configure(WithErrorHandler(handler))
+}
+
+// SetLogHandler 设置提示信息处理函数, 为nil时通过logger输出
+func (w *FileWatcher) SetLogHandler(handler func(string)) error {
+	return w.configure(WithLogHandler(handler))
+}
+
+// SetLogger 设置输出日志使用的logger, 为nil时使用slog.Default()
+func (w *FileWatcher) SetLogger(logger *slog.Logger) error {
+	return w.configure(WithLogger(logger))
+}
+
+// SetDecompress 设置是否自动解压.gz、.zst文件后再读取
+func (w *FileWatcher) SetDecompress(decompress bool) error {
+	return w.configure(WithDecompress(decompress))
+}
+
+// SetRecursive 设置是否监控子文件夹, 默认为true; 为false时只监控文件夹下直接存放的文件
+func (w *FileWatcher) SetRecursive(recursive bool) error {
+	return w.configure(WithRecursive(recursive))
+}
+
+// SetMaxDepth 设置监控的子文件夹最大深度, 1表示只监控直接子文件夹, 0表示不限制
+func (w *FileWatcher) SetMaxDepth(n int) error {
+	return w.configure(WithMaxDepth(n))
+}
+
+// SetFollowSymlinks 设置是否监听指向普通文件的符号链接, 读取链接指向的文件, 结果中的路径仍为链接路径
+func (w *FileWatcher) SetFollowSymlinks(follow bool) error {
+	return w.configure(WithFollowSymlinks(follow))
+}
+
+// SetRecordDelimiter 设置多行记录的分隔函数, 设置后按记录而非按行发送, 函数返回true的行为一条记录的最后一行
+func (w *FileWatcher) SetRecordDelimiter(delimiter func(line []byte) bool) error {
+	return w.configure(WithRecordDelimiter(delimiter))
+}
+
+// SetLineFilter 设置行过滤函数, 返回false的行不发送, 结束标记行不受影响
+func (w *FileWatcher) SetLineFilter(filter func(line []byte) bool) error {
+	return w.configure(WithLineFilter(filter))
+}
+
+// SetLineTransformer 设置行转换函数, 在过滤之后、写入批次之前调用, 结束标记行不受影响
+func (w *FileWatcher) SetLineTransformer(transformer func(line []byte) []byte) error {
+	return w.configure(WithLineTransformer(transformer))
+}
+
+// SetRescanInterval 设置定期重新扫描文件夹的间隔, 用于补充遗漏的文件创建事件, 0表示不重新扫描
+func (w *FileWatcher) SetRescanInterval(dur time.Duration) error {
+	return w.configure(WithRescanInterval(dur))
+}
+
+// SetCreateDir 设置监控文件夹不存在时以perm权限自动创建, 0表示不创建
+func (w *FileWatcher) SetCreateDir(perm os.FileMode) error {
+	return w.configure(WithCreateDir(perm))
+}
+
+// SetWaitForDir 设置启动时等待监控文件夹出现的最长时间, 0表示不等待
+func (w *FileWatcher) SetWaitForDir(timeout time.Duration) error {
+	return w.configure(WithWaitForDir(timeout))
+}
+
+// SetStatsObserver 设置统计事件的接收者
+func (w *FileWatcher) SetStatsObserver(observer StatsObserver) error {
+	return w.configure(WithStatsObserver(observer))
+}
+
+// SetPollingInterval 设置以轮询代替fsnotify监听单个文件的变化, 0表示不轮询
+func (w *FileWatcher) SetPollingInterval(dur time.Duration) error {
+	return w.configure(WithPollingInterval(dur))
+}
+
+// SetMaxConcurrentFiles 设置同时监听的最大文件数, 超出的文件按修改时间从早到晚排队等待, 0表示不限制
+func (w *FileWatcher) SetMaxConcurrentFiles(n int) error {
+	return w.configure(WithMaxConcurrentFiles(n))
+}
+
+// SetSubscribePolicy 设置订阅者通道已满时的处理方式, 默认丢弃
+func (w *FileWatcher) SetSubscribePolicy(policy SubscribePolicy) error {
+	return w.configure(WithSubscribePolicy(policy))
 }
 
 // GetResChan 获取结果通道
 func (w *FileWatcher) GetResChan() <-chan FileContent {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	return w.ResChan
 }
 
 // NewWatcher 新建一个watcher, 如果声明多个Watcher, 请自行把控文件夹被重复监控的问题
-func NewWatcher() *FileWatcher {
+func NewWatcher(opts ...Option) (*FileWatcher, error) {
 	watcher := &FileWatcher{
-		dirPath:             DefaultDirPath,
-		fileRegexp:          DefaultFileRegexp,
-		completeMarker:      DefaultCompleteMarker,
-		removeAfterComplete: false,
-		maxNoUpdateTime:     DefaultMaxNoUpdateTime,
-		ResChan:             make(chan FileContent),
+		settings: settings{
+			fileRe:              regexp.MustCompile(DefaultFileRegexp),
+			completeMarker:      DefaultCompleteMarker,
+			maxLineBytes:        DefaultMaxLineBytes,
+			flushInterval:       DefaultFlushInterval,
+			removeAfterComplete: false,
+			maxNoUpdateTime:     DefaultMaxNoUpdateTime,
+			recursive:           true,
+			ignoreHidden:        true,
+			cursorSync:          true,
+		},
+		stopChan: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(watcher); err != nil {
+			return nil, err
+		}
+	}
+	watcher.ResChan = make(chan FileContent, watcher.resChanSize)
+	return watcher, nil
+}
+
+// Clone 复制当前watcher的全部配置, 返回一个新的未运行的watcher.
+// 新watcher拥有独立的结果通道、运行状态与统计信息, 启动、停止均不影响原watcher; 回调函数与原watcher共用.
+// WithInMemoryCursors的内存游标不共用, 新watcher从空的游标开始; WithCursorStore设置的存储仍共用
+func (w *FileWatcher) Clone() *FileWatcher {
+	w.mu.Lock()
+	s := w.settings
+	w.mu.Unlock()
+	s.dirPaths = slices.Clone(s.dirPaths)
+	if _, ok := s.cursorStore.(*memoryCursorStore); ok {
+		s.cursorStore = newMemoryCursorStore()
+	}
+	return &FileWatcher{
+		settings: s,
+		ResChan:  make(chan FileContent, s.resChanSize),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Stop 停止监控任务, 各文件发送剩余内容、保存游标后关闭结果通道. 消费者停止读取时最多等待1秒便放弃发送剩余内容,
+// 游标停在已发送的内容处, 未发送的内容在下次Start时重新读取.
+// 若设置了停止超时时间, 超时后返回ErrStopTimeout, 结果通道将在剩余协程退出后再关闭, 此时再次Start会先等待其退出.
+// 可重复调用, 停止后可再次Start, 将从已保存的游标处继续读取
+func (w *FileWatcher) Stop() error {
+	done, ok := w.teardown(true)
+	if !ok {
+		return nil
+	}
+	if w.stopTimeout <= 0 {
+		<-done
+		return nil
+	}
+	timer := time.NewTimer(w.stopTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%w: %v", ErrStopTimeout, w.stopTimeout)
+	}
+}
+
+// teardown 通知所有监控协程退出, 返回的通道在协程全部退出后关闭; closeRes为true时随后关闭结果通道.
+// 已调用过Stop时ok为false; 只通知退出(如监控任务因错误退出、Restart)时结果通道保持打开, 再次Start后继续使用
+func (w *FileWatcher) teardown(closeRes bool) (done <-chan struct{}, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closing || (!closeRes && w.stopped) {
+		return w.stopDone, false
+	}
+	w.closing = closeRes
+	if !w.stopped {
+		w.stopped = true
+		close(w.stopChan)
+	}
+	prev, next := w.stopDone, make(chan struct{})
+	w.stopDone = next
+	resChan := w.ResChan
+	go func() {
+		// 等待之前的teardown结束, 保证再次Start前所有对wg的Wait均已返回
+		if prev != nil {
+			<-prev
+		}
+		w.wg.Wait()
+		if closeRes {
+			close(resChan)
+			w.info("文件夹监控已停止", slog.Any("dirs", w.currentDirs()))
+		}
+		close(next)
+	}()
+	return next, true
+}
+
+// Wait 阻塞至Start退出且所有文件的监听协程(包括直接调用Watch、WatchFile的)都已结束.
+// 通常在Stop之后调用, 返回后结果通道不会再有新的内容
+func (w *FileWatcher) Wait() {
+	w.wg.Wait()
+}
+
+// Drained 返回一个通道, 在Start退出且所有文件的监听协程都已结束后关闭
+func (w *FileWatcher) Drained() <-chan struct{} {
+	ch := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(ch)
+	}()
+	return ch
+}
+
+// Pause 暂停读取文件内容, 各文件的事件监听保持不变.
+// 暂停期间不发送内容、不推进游标, 也不计算文件的未更新时长
+func (w *FileWatcher) Pause() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.paused {
+		return
+	}
+	w.paused = true
+	w.resumeCh = make(chan struct{})
+}
+
+// Resume 恢复读取, 并立即扫描一次暂停期间积累的内容
+func (w *FileWatcher) Resume() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.paused {
+		return
+	}
+	w.paused = false
+	close(w.resumeCh)
+}
+
+// pauseState 获取当前是否暂停, 暂停时同时返回等待恢复的通道, 未暂停时通道为nil
+func (w *FileWatcher) pauseState() (bool, <-chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.paused {
+		return false, nil
 	}
-	return watcher
+	return true, w.resumeCh
+}
+
+// stopSignal 获取当前的停止信号通道
+func (w *FileWatcher) stopSignal() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stopChan
+}
+
+// isStopped 是否已调用Stop且尚未重新Start
+func (w *FileWatcher) isStopped() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stopped
+}
+
+// resultSink 单个文件的监听开始时获取的结果通道及停止信号, 之后的发送均通过它进行,
+// 避免再次Start重新创建结果通道时与仍在退出的发送者竞争
+type resultSink struct {
+	ch   chan<- FileContent
+	stop <-chan struct{}
+}
+
+// sink 获取当前的结果通道及停止信号, 已调用Stop时ok为false
+func (w *FileWatcher) sink() (s resultSink, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return resultSink{ch: w.ResChan, stop: w.stopChan}, !w.stopped
+}
+
+// send 发送内容至结果通道, ctx结束或已调用Stop时放弃发送并返回false, 不会因消费者停止读取而阻塞Stop
+func (s resultSink) send(ctx context.Context, c FileContent) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-s.stop:
+		return false
+	default:
+	}
+	select {
+	case s.ch <- c:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-s.stop:
+		return false
+	}
+}
+
+// sendWithin 最多等待d发送内容, 超时返回false, 用于停止时发送剩余内容
+func (s resultSink) sendWithin(c FileContent, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case s.ch <- c:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// resetStop 若之前已停止, 则重新初始化停止信号以便再次Start, 结果通道已被Stop关闭时一并重新创建.
+// 停止超时后再次Start时, 先等待上一次的协程全部退出, 避免其与新任务共用wg
+func (w *FileWatcher) resetStop() <-chan struct{} {
+	w.mu.Lock()
+	if w.stopped && w.stopDone != nil {
+		done := w.stopDone
+		w.mu.Unlock()
+		<-done
+		w.mu.Lock()
+	}
+	defer w.mu.Unlock()
+	if w.stopped {
+		w.stopped = false
+		w.stopChan = make(chan struct{})
+		w.stopDone = nil
+	}
+	if w.closing {
+		w.closing = false
+		w.ResChan = make(chan FileContent, w.resChanSize)
+	}
+	return w.stopChan
+}
+
+// withStop 派生一个在parent结束或调用Stop时都会被取消的context
+func (w *FileWatcher) withStop(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	stop := w.stopSignal()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
 }
 
 // Start 开始监控任务
-func (w *FileWatcher) Start() (err error) {
-	if !atomic.CompareAndSwapInt64(&w.watching, 0, 1) {
-		fmt.Printf("文件夹(%s)正在被监控中, 无需再起监控任务\n", w.dirPath)
+func (w *FileWatcher) Start() error {
+	return w.StartContext(context.Background())
+}
+
+// StartContext 开始监控任务, ctx结束时等同于调用Stop, 并返回ctx.Err()
+func (w *FileWatcher) StartContext(parent context.Context) error {
+	return w.start(parent, nil)
+}
+
+// start 执行监控任务, 事件溢出时自动重启.
+// ready非nil时, 初始化完成(或失败)后会向其发送一次结果
+func (w *FileWatcher) start(parent context.Context, ready chan<- error) error {
+	for {
+		err := w.run(parent, ready)
+		if !errors.Is(err, fsnotify.ErrEventOverflow) {
+			return err
+		}
+		ready = nil
+		w.warn("监控事件溢出, 重新开始监控任务")
+	}
+}
+
+func (w *FileWatcher) run(parent context.Context, ready chan<- error) (err error) {
+	// 与configure互斥, 避免启动时配置仍在被修改
+	w.mu.Lock()
+	swapped := atomic.CompareAndSwapInt64(&w.watching, 0, 1)
+	w.mu.Unlock()
+	if !swapped {
+		w.info("文件夹正在被监控中, 无需再起监控任务", slog.Any("dirs", w.currentDirs()))
+		if ready != nil {
+			ready <- ErrAlreadyWatching
+		}
 		return nil
 	}
+	defer func() {
+		// 初始化失败时通知调用方
+		if ready != nil {
+			ready <- err
+		}
+	}()
+	if err := w.prepareDirs(parent); err != nil {
+		atomic.StoreInt64(&w.watching, 0)
+		return err
+	}
+	if err := w.Validate(); err != nil {
+		atomic.StoreInt64(&w.watching, 0)
+		return err
+	}
 
-	go w.Scan()
+	w.resetStop()
+	ctx, cancel := w.withStop(parent)
+	defer cancel()
+	// 文件的监听只随parent结束或Stop而结束, 事件溢出重启时不中断, 重启后的扫描会跳过仍在监听的文件
+	files, cancelFiles := w.withStop(parent)
 	defer func() {
-		if err == fsnotify.ErrEventOverflow {
-			go w.Start()
+		if !errors.Is(err, fsnotify.ErrEventOverflow) {
+			cancelFiles()
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		// 外部ctx结束时, 清理所有监控协程并关闭结果通道
+		if parent.Err() != nil {
+			w.Stop()
+		}
+	}()
+
+	w.wg.Add(2)
+	defer w.wg.Done()
+	go func() {
+		defer w.wg.Done()
+		w.scanExisting(files)
+	}()
+	defer func() {
+		// 因错误退出时各文件的监听随之结束, 结果通道保持打开, 以便Restart后在原通道上继续发送;
+		// 不再重启时由调用方Stop关闭结果通道. 事件溢出时会自动重启, 无需处理
+		if err != nil && !errors.Is(err, fsnotify.ErrEventOverflow) {
+			w.teardown(false)
 		}
 	}()
 
 	defer func() {
 		swapped := atomic.CompareAndSwapInt64(&w.watching, 1, 0)
-		fmt.Printf("监控任务结束了, err: %v, 监控状态重置结果: %v\n", err, swapped)
+		w.info("监控任务结束了", slog.Any("err", err), slog.Bool("reset", swapped))
 	}()
 
 	// 开始监视文件变更
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		return fmt.Errorf("创建watcher失败: %w", err)
+		return fmt.Errorf("创建watcher失败: %w", wrapWatchLimit("", err))
 	}
 	defer watcher.Close()
 
+	// 运行期间允许通过AddDir、RemoveDir调整监控的文件夹
+	w.mu.Lock()
+	w.fsWatcher = watcher
+	w.filesCtx = files
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		w.fsWatcher = nil
+		w.filesCtx = nil
+		w.mu.Unlock()
+		// 延迟监听的空文件在下次启动扫描时重新记录
+		w.emptyFiles.Range(func(key, _ any) bool {
+			w.emptyFiles.Delete(key)
+			return true
+		})
+	}()
+
 	// 添加监视的文件夹
-	if err := watcher.Add(w.dirPath); err != nil {
-		return fmt.Errorf("将文件夹添加至watcher时失败: %w", err)
-	}
-	if err := filepath.Walk(w.dirPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	for _, dirPath := range w.currentDirs() {
+		if err := watcher.Add(dirPath); err != nil {
+			return fmt.Errorf("将文件夹添加至watcher时失败: %w", wrapWatchLimit(dirPath, err))
 		}
-		// 只添加文件夹和符号链接到监控器
-		if info.IsDir() || (info.Mode()&os.ModeSymlink != 0) {
-			if err := watcher.Add(path); err != nil {
-				return fmt.Errorf("添加文件夹到监控器时失败: %w", err)
-			}
+		if err := w.addDirTree(watcher, dirPath, dirPath); err != nil {
+			return err
 		}
-		return nil
-	}); err != nil {
-		return err
+	}
+
+	if ready != nil {
+		ready <- nil
+		ready = nil
+	}
+
+	var rescanC <-chan time.Time
+	if w.rescanInterval > 0 {
+		rescanTicker := time.NewTicker(w.rescanInterval)
+		defer rescanTicker.Stop()
+		rescanC = rescanTicker.C
 	}
 
 	for {
 		select {
+		case <-ctx.Done():
+			return parent.Err()
+		case <-rescanC:
+			w.wg.Add(1)
+			go func() {
+				defer w.wg.Done()
+				w.Scan(files)
+			}()
 		case event := <-watcher.Events:
 			if strings.HasSuffix(event.Name, ".cursor") {
 				watcher.Remove(event.Name)
 				continue
 			}
+			// 延迟监听的空文件被写入后开始监听, 被删除后不再记录
+			if event.Op&fsnotify.Write == fsnotify.Write {
+				w.promoteEmpty(files, event.Name)
+			}
+			// 根文件夹被删除后, 等待其重新创建再重新监控
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				w.emptyFiles.Delete(fileKey(event.Name))
+				if dirPath, ok := w.rootDir(event.Name); ok {
+					w.wg.Add(1)
+					go func() {
+						defer w.wg.Done()
+						w.reattachDir(ctx, files, dirPath)
+					}()
+					continue
+				}
+			}
 			// 处理文件创建的事件
 			if event.Op&fsnotify.Create == fsnotify.Create {
 				isDir, err := isDirectory(event.Name)
 				if err != nil {
-					fmt.Println("判断文件类型失败:", err)
+					w.errorf("判断文件类型失败: %w", err)
 					continue
 				}
 				if isDir {
-					fmt.Printf("将文件夹添加至watcher: %s\n", event.Name)
-					watcher.Add(event.Name)
+					// 被排除、隐藏或超出监控深度的文件夹不添加
+					root := w.dirOf(event.Name)
+					if !w.dirAllowed(root, event.Name) {
+						continue
+					}
+					// 新建的文件夹下可能已经有子文件夹, 需一并添加
+					w.info("将文件夹添加至watcher", slog.String("dir", event.Name))
+					if err := w.addDirTree(watcher, root, event.Name); err != nil {
+						w.errorf("添加文件夹(%s)到监控器时失败: %w", event.Name, err)
+					}
+					// 如mkdir -p后立即写入, 子文件夹中的文件可能在添加到监控器之前就已创建, 需扫描一次
+					newDir := event.Name
+					w.wg.Add(1)
+					go func() {
+						defer w.wg.Done()
+						w.walkFiles(ctx, root, newDir, func(path string) {
+							w.watchNew(files, path)
+						})
+					}()
 					continue
 				}
 
 				filePath := event.Name
-				re := regexp.MustCompile(w.fileRegexp)
-				// 使用正则表达式提取匹配的子串
-				matches := re.FindStringSubmatch(filePath)
-				if len(matches) == 0 {
+				// 正在读取的文件被重新创建或覆盖, 通知其监听协程核对文件是否已被替换
+				if w.isWatched(filePath) {
+					w.notifyReplaced(filePath)
+					continue
+				}
+				if !w.fileAllowed(w.dirOf(filePath), filePath) {
 					watcher.Remove(filePath)
-					fmt.Printf("非预期的文件: %s, 已忽略监控\n", filePath)
+					w.info("非预期的文件, 已忽略监控", slog.String("file", filePath))
 					continue
 				}
 
-				go w.Watch(filePath)
+				w.watchNew(files, filePath)
 			}
 		case err := <-watcher.Errors:
 			return fmt.Errorf("watcher.Errors: %w", err)
@@ -173,12 +1031,67 @@ func (w *FileWatcher) Start() (err error) {
 	}
 }
 
-// Scan 扫描一次目录
-func (w *FileWatcher) Scan() {
-	fmt.Println("服务启动时扫描一遍文件目录, 正在将未上报的内容进行上报")
-	filepath.Walk(w.dirPath, func(path string, info os.FileInfo, err error) error {
+// Scan 扫描一次目录, 并清理文件已不存在的游标文件(见SweepCursors)
+func (w *FileWatcher) Scan(ctx context.Context) {
+	w.info("服务启动时扫描一遍文件目录, 正在将未上报的内容进行上报")
+	var found []string
+	for _, dirPath := range w.currentDirs() {
+		found = append(found, w.findFiles(ctx, dirPath)...)
+	}
+	w.watchScanned(ctx, found)
+	if n := w.SweepCursors(ctx); n > 0 {
+		w.info("已清理游标文件", slog.Int("count", n))
+	}
+	w.info("文件目录扫描结束")
+}
+
+// scanExisting 启动时扫描一次目录. 设置了只读取新内容时, 没有游标的已有文件从末尾开始监听
+func (w *FileWatcher) scanExisting(ctx context.Context) {
+	if !w.tailExisting {
+		w.Scan(ctx)
+		return
+	}
+	w.info("服务启动时扫描一遍文件目录, 已有文件只读取新增内容")
+	var found []string
+	for _, dirPath := range w.currentDirs() {
+		found = append(found, w.findFiles(ctx, dirPath)...)
+	}
+	w.sortScanned(found)
+	for _, path := range found {
+		if w.isWatched(path) {
+			continue
+		}
+		if err := w.tailCursor(path); err != nil {
+			w.errorf("设置文件(%s)初始游标失败: %w", path, err)
+			continue
+		}
+		w.scanWatch(ctx, path)
+	}
+	w.info("文件目录扫描结束")
+}
+
+// scanDir 扫描一次指定的目录, 对匹配的文件开始监听
+func (w *FileWatcher) scanDir(ctx context.Context, dirPath string) {
+	w.watchScanned(ctx, w.findFiles(ctx, dirPath))
+}
+
+// findFiles 遍历指定的目录, 返回其中匹配的文件
+func (w *FileWatcher) findFiles(ctx context.Context, dirPath string) []string {
+	var found []string
+	w.walkFiles(ctx, dirPath, dirPath, func(path string) {
+		found = append(found, path)
+	})
+	return found
+}
+
+// walkFiles 遍历指定的目录, 对其中匹配的文件调用fn, 监控深度相对于root计算
+func (w *FileWatcher) walkFiles(ctx context.Context, root, dirPath string, fn func(path string)) {
+	filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
 		if err != nil {
-			fmt.Printf("遍历文件夹(%v)失败: %v\n", path, err)
+			w.errorf("遍历文件夹(%v)失败: %w", path, err)
 			return err
 		}
 
@@ -186,141 +1099,483 @@ func (w *FileWatcher) Scan() {
 			return nil
 		}
 
-		if info.IsDir() || (info.Mode()&os.ModeSymlink != 0) {
+		if info.IsDir() {
+			// 不进入超出监控深度的子文件夹
+			if !w.dirAllowed(root, path) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !w.followSymlinks {
+				return nil
+			}
+			// 只跟随指向普通文件的符号链接
+			if target, err := os.Stat(path); err != nil || !target.Mode().IsRegular() {
+				return nil
+			}
+		}
 
-		filePath := path
-		re := regexp.MustCompile(w.fileRegexp)
-		// 使用正则表达式提取匹配的子串
-		matches := re.FindStringSubmatch(filePath)
-		if len(matches) > 0 {
-			fmt.Printf("Watching: %s\n", path)
-			go w.Watch(path)
+		if w.fileAllowed(root, path) {
+			fn(path)
 		}
 		return nil
 	})
-	fmt.Println("文件目录扫描结束")
 }
 
-// Watch 对单个文件进行监听
-func (w *FileWatcher) Watch(filePath string) (err error) {
-	defer func() {
-		if err != nil {
-			fmt.Println(err)
+// fileAllowed 判断root下的文件是否需要监听: 文件名匹配, 且设置了忽略隐藏文件时路径中不含隐藏文件(夹)
+func (w *FileWatcher) fileAllowed(root, filePath string) bool {
+	if w.ignoreHidden && isHidden(root, filePath) {
+		return false
+	}
+	return w.matchFile(root, filePath)
+}
+
+// isHidden 判断path相对于root的路径中是否有以.开头的部分, root本身不参与判断
+func isHidden(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.HasPrefix(part, ".") && part != ".." {
+			return true
 		}
-		fmt.Printf("%s 文件内容监听结束\n", filePath)
-	}()
+	}
+	return false
+}
+
+// WatchFile 监听指定的单个文件直至其读取完毕, 不要求位于监控文件夹下, 也不受文件名正则表达式的限制.
+// 内容同样发送至结果通道, 游标文件创建在该文件旁; 文件无法打开时立即返回错误.
+// 无需调用Start, 可通过Stop结束, 并纳入Wait的等待范围
+func (w *FileWatcher) WatchFile(filePath string) error {
+	if err := checkRegularFile(filePath); err != nil {
+		return err
+	}
+	return w.Watch(context.Background(), filePath)
+}
+
+// WatchUntil 与WatchFile相同, 但到达deadline时不再监听, 连同剩余内容发送StatusDeadlineExceeded.
+// 适用于已知文件最晚完成时间的场景, 无需为此设置全局的maxNoUpdateTime
+func (w *FileWatcher) WatchUntil(filePath string, deadline time.Time) error {
+	if err := checkRegularFile(filePath); err != nil {
+		return err
+	}
+	return w.watch(context.Background(), filePath, deadline)
+}
 
-	var f *os.File
-	f, err = os.OpenFile(filePath, os.O_RDONLY, os.ModePerm)
+// checkRegularFile 检查文件能否打开且为普通文件
+func checkRegularFile(filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("打开文件(%s)失败: %w", filePath, wrapPermission(filePath, err))
+	}
+	info, err := f.Stat()
+	f.Close()
 	if err != nil {
-		return fmt.Errorf("打开文件失败: %w", err)
+		return fmt.Errorf("查询文件(%s)信息时失败: %w", filePath, err)
 	}
-	defer f.Close()
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%w: %s", ErrNotRegularFile, filePath)
+	}
+	return nil
+}
+
+// Watch 对单个文件进行监听, ctx结束或调用Stop时发送剩余内容并保存游标后退出.
+// 直接调用时同样纳入Wait与Stop的等待范围
+func (w *FileWatcher) Watch(ctx context.Context, filePath string) error {
+	return w.watch(ctx, filePath, time.Time{})
+}
 
-	cursorFile := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + CursorFileSuffix
-	offset, _ := readCursor(cursorFile)
-	if _, err = f.Seek(offset, io.SeekStart); err != nil {
-		return fmt.Errorf("设置初始seek失败: %w", err)
+// watch 监听单个文件, deadline不为零值时到达后结束监听
+func (w *FileWatcher) watch(ctx context.Context, filePath string, deadline time.Time) (err error) {
+	w.wg.Add(1)
+	defer w.wg.Done()
+	// 直接调用时监控任务可能未运行, 读取期间同样拒绝修改配置
+	w.enterRead()
+	defer w.leaveRead()
+	// Stop之后结果通道会被关闭, 不能再发送内容
+	out, ok := w.sink()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrStopped, filePath)
 	}
-	fmt.Printf("准备读取文件, file: %s, offset: %d\n", filePath, offset)
+	// 同一文件同时只允许一个协程读取
+	if !w.claimFile(filePath) {
+		return fmt.Errorf("%w: %s", ErrFileWatching, filePath)
+	}
+	defer w.releaseFile(filePath)
+	dirPath := w.dirOf(filePath)
+	w.fileStarted(dirPath, filePath)
+	defer w.fileStopped(dirPath, filePath)
+	defer func() {
+		if err != nil {
+			w.fileErrored(dirPath, filePath)
+			w.handleErr(err)
+		}
+		w.info("文件内容监听结束", slog.String("file", filePath))
+	}()
+
+	ctx, cancel := w.withStop(ctx)
+	defer cancel()
+	// 监听期间沿用开始时的配置, 不受Reconfigure影响
+	cfg := w.fileConfig(filePath)
 
-	// 打开游标文件写
-	var cursorFW *os.File
-	cursorFW, err = os.OpenFile(cursorFile, os.O_WRONLY|os.O_CREATE, os.ModePerm)
+	fr, err := w.openFile(filePath)
 	if err != nil {
-		return fmt.Errorf("打开游标文件失败: %w", err)
+		// 打开失败时同样告知调用方文件的监听已结束
+		if w.onFileComplete != nil {
+			w.onFileComplete(filePath, err)
+		}
+		return err
 	}
-	defer cursorFW.Close()
+	// 文件轮转后fr会被替换, 需关闭最终的fr
+	defer func() { fr.Close() }()
+	f, offset := fr.f, fr.offset
+	w.info("准备读取文件", slog.String("file", filePath), slog.Int64("offset", offset))
+	status := w.registerFile(filePath, offset, cancel)
+	defer w.unregisterFile(status)
+	if w.onFileStart != nil {
+		w.onFileStart(filePath)
+	}
+	if fr.truncated && !out.send(ctx, FileContent{FilePath: filePath, Pattern: cfg.pattern, Profile: cfg.profile, Tags: cfg.tags, Truncated: true, Timestamp: time.Now()}) {
+		return nil
+	}
+	// 读取完毕或因错误退出时调用回调, 被停止、文件被删除时不调用
+	completed := false
+	defer func() {
+		if (completed || err != nil) && w.onFileComplete != nil {
+			w.onFileComplete(filePath, err)
+		}
+	}()
 
-	maxNoUpdateTime := 4 * time.Hour
-	timer := time.NewTicker(maxNoUpdateTime)
-	defer timer.Stop()
 	fsInfo, err := f.Stat()
 	if err != nil {
 		return fmt.Errorf("查询文件信息时失败: %w", err)
 	}
 	longTimeNoUpdate := false
-	if time.Since(fsInfo.ModTime()) > maxNoUpdateTime {
+	if time.Since(fsInfo.ModTime()) > cfg.maxNoUpdateTime {
 		// 长时间不更新认为该任务已停止
 		longTimeNoUpdate = true
 	}
 
-	scanChan := make(chan bool, 2)
-	go w.watchFileEvent(filePath, scanChan)
+	scanChan := make(chan ContentStatus, 2)
+	// 文件事件监听出错时, 错误在通知StatusError之前写入
+	eventErr := make(chan error, 1)
+	watchEvents := func() {
+		// 以正在读取的文件为准判断文件路径是否已指向其他文件, 获取失败时不做判断
+		origin, _ := fr.f.Stat()
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			if w.pollingInterval > 0 {
+				w.pollFileEvent(ctx, filePath, origin, cfg.maxNoUpdateTime, scanChan, eventErr)
+				return
+			}
+			w.watchFileEvent(ctx, filePath, origin, status.replaced, cfg.maxNoUpdateTime, scanChan, eventErr)
+		}()
+	}
+	watchEvents()
 
-	// 计时器, 2秒内至少发送一次
-	maxSendDur := 2 * time.Second
+	// 计时器, 每个发送间隔内至少发送一次
+	maxSendDur := w.flushInterval
+	if maxSendDur <= 0 {
+		maxSendDur = DefaultFlushInterval
+	}
 	sendTimer := time.NewTicker(maxSendDur)
 	defer sendTimer.Stop()
+	var deadlineC <-chan time.Time
+	if !deadline.IsZero() {
+		deadlineTimer := time.NewTimer(time.Until(deadline))
+		defer deadlineTimer.Stop()
+		deadlineC = deadlineTimer.C
+	}
 
 	const maxBatchCnt = 1000
+	// 缓冲区发送后即被复用, 发送的内容均为副本, 避免调用方读取时被覆盖
 	var batchLog = bytes.NewBuffer(make([]byte, 0, 1024*1024)) // 申请1M容量
 	var batchCnt int
+	var record bytes.Buffer // 多行记录模式下尚未遇到分隔行的记录
+	span := lineSpan{line: fr.line}
+	saver := w.newCursorSaver(filePath)
+	// 确认模式下记录已发送未确认的内容, 游标只推进到已确认的内容
+	var acks *ackTracker
+	var ackNotify <-chan struct{}
+	var ackCheck <-chan time.Time
+	if w.ackMode {
+		acks = newAckTracker()
+		ackNotify = acks.notify
+		if w.ackTimeout > 0 {
+			ackTicker := time.NewTicker(w.ackTimeout)
+			defer ackTicker.Stop()
+			ackCheck = ackTicker.C
+		}
+	}
+	// send 发送内容, 停止后改为最多等待stopFlushWait, 不因消费者停止读取而阻塞Stop
+	send := func(c FileContent) bool { return out.send(ctx, c) }
+	// dropped 有内容未能发送(被停止), 之后的内容均不再发送, 游标停在已发送的内容处, 下次监听时重新读取
+	dropped := false
+	// deliver 发送内容并保存游标, final为true时立即写入游标; 确认模式下游标在内容被确认后才保存
+	deliver := func(c FileContent, final bool) bool {
+		if dropped {
+			return false
+		}
+		c = w.packContent(c)
+		if acks != nil {
+			c = acks.add(c, offset, span.line)
+		}
+		if !send(c) {
+			dropped = true
+			return false
+		}
+		if acks != nil {
+			return true
+		}
+		save := saver.save
+		if final {
+			save = saver.saveNow
+		}
+		if err := save(fr, offset, span.line); err != nil {
+			w.handleErr(err)
+		}
+		return true
+	}
+	// settleAcks 保存已确认内容的游标, 并重新发送被拒绝的内容, timeout大于0时还重新发送超时未确认的内容
+	settleAcks := func(timeout time.Duration) {
+		if off, line, ok := acks.commit(); ok {
+			if err := saver.save(fr, off, line); err != nil {
+				w.handleErr(err)
+			}
+		}
+		for _, c := range acks.due(timeout) {
+			w.info("重新发送未确认的内容", slog.String("file", filePath), slog.Int64("line_start", c.LineStart))
+			if !send(c) {
+				dropped = true
+				return
+			}
+		}
+	}
+	// waitAcks 确认模式下等待已发送的内容全部确认并保存游标, ctx结束时返回false
+	waitAcks := func() bool {
+		if acks == nil {
+			return true
+		}
+		settleAcks(0)
+		for acks.pending() > 0 {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-ackNotify:
+				settleAcks(0)
+			case <-ackCheck:
+				settleAcks(w.ackTimeout)
+			}
+		}
+		if err := saver.flush(); err != nil {
+			w.handleErr(err)
+		}
+		return true
+	}
+	// finish 文件不再监听时, 连同剩余内容(包括未完成的多行记录)发送一次结束原因并保存游标
+	finish := func(status ContentStatus) {
+		batchLog.Write(record.Bytes())
+		start, end := span.take()
+		deliver(FileContent{FilePath: filePath, Pattern: cfg.pattern, Profile: cfg.profile, Tags: cfg.tags, Content: flushSafeUTF8(batchLog, true), Status: status, Timestamp: time.Now(), LineStart: start, LineEnd: end}, true)
+		waitAcks()
+	}
 	for {
+		_, resume := w.pauseState()
 		select {
-		case ifScan := <-scanChan:
-			if !ifScan { // false表示不需要再扫描了
+		case <-resume:
+			// 恢复后立即扫描一次
+			select {
+			case scanChan <- StatusContinue:
+			default:
+			}
+		case <-ctx.Done():
+			// 停止前发送剩余内容(包括未完成的多行记录)并保存游标; 消费者未及时接收时不再等待,
+			// 游标停在已发送的内容处
+			send = func(c FileContent) bool { return out.sendWithin(c, stopFlushWait) }
+			batchLog.Write(record.Bytes())
+			if batchLog.Len() > 0 {
+				start, end := span.take()
+				deliver(FileContent{FilePath: filePath, Pattern: cfg.pattern, Profile: cfg.profile, Tags: cfg.tags, Content: flushSafeUTF8(batchLog, true), EOF: false, Timestamp: time.Now(), LineStart: start, LineEnd: end}, false)
+			}
+			if acks == nil && !dropped {
+				err = saver.saveNow(fr, offset, span.line)
+			} else if acks == nil {
+				err = saver.flush()
+			} else {
+				// 停止时不再等待确认, 未确认的内容在下次监听时重新读取
+				if off, line, ok := acks.commit(); ok {
+					err = saver.saveNow(fr, off, line)
+				} else {
+					err = saver.flush()
+				}
+			}
+			if err != nil {
+				w.handleErr(err)
+			}
+			return nil
+		case <-ackNotify:
+			settleAcks(0)
+		case <-ackCheck:
+			settleAcks(w.ackTimeout)
+		case reason := <-scanChan:
+			// 支持轮转时, 文件被删除或重命名后先读完旧文件的剩余内容, 再等待同名的新文件.
+			// 文件路径已指向其他文件时同样处理, 避免继续读取旧文件而错过新文件的内容
+			rotating := (reason == StatusRemoved && w.rotationGrace > 0) || reason == statusReplaced
+			if reason != StatusContinue && !rotating { // 文件不再有后续内容, 发送剩余内容并告知结束原因
+				finish(reason)
+				if reason == StatusError {
+					// 文件事件监听出错, 错误交由OnFileComplete及错误处理函数
+					select {
+					case err = <-eventErr:
+					default:
+						err = fmt.Errorf("监听文件(%s)事件时发生错误", filePath)
+					}
+					return err
+				}
+				// 长时间未更新同样视为读取完毕
+				completed = reason == StatusTimeout || reason == StatusComplete
 				return nil
 			}
-			scanner := bufio.NewScanner(f)
+			if paused, _ := w.pauseState(); paused && !rotating { // 暂停期间不读取, 恢复时会重新扫描
+				continue
+			}
+			scanner := w.newScanner(fr)
 			for scanner.Scan() {
-				batchCnt++
 				line := scanner.Bytes()
 				// 更新光标位置
-				offset, _ = f.Seek(0, io.SeekCurrent)
+				offset = fr.position()
+				w.updateFile(status, offset)
+				if w.maxFileSize > 0 && !fr.skipped && offset > w.maxFileSize {
+					w.warn("文件在监听期间超过大小限制, 不再读取", slog.String("file", filePath),
+						slog.Int64("offset", offset), slog.Int64("limit", w.maxFileSize))
+					finish(StatusTooLarge)
+					return fmt.Errorf("%w: %s, 限制: %d", ErrFileTooLarge, filePath, w.maxFileSize)
+				}
 
-				eof := string(line) == w.completeMarker
-				line = append(line, '\n')
+				w.lineRead(dirPath, filePath, len(line)+1)
+				span.line++
+
+				line, eof, keep := w.processLine(line, cfg)
+				if !keep {
+					continue
+				}
+				span.keep()
+				if w.recordDelimiter != nil {
+					if !eof {
+						// 多行记录模式下累积至分隔行, 整条记录作为一个内容单独发送
+						record.Write(line)
+						record.WriteByte('\n')
+						if !w.recordDelimiter(line) {
+							continue
+						}
+						start, end := span.take()
+						deliver(FileContent{FilePath: filePath, Pattern: cfg.pattern, Profile: cfg.profile, Tags: cfg.tags, Content: bytes.Clone(record.Bytes()), Timestamp: time.Now(), LineStart: start, LineEnd: end}, false)
+						record.Reset()
+						sendTimer.Reset(maxSendDur)
+						continue
+					}
+					// 未完成的记录随结束标记一起发送
+					batchLog.Write(record.Bytes())
+					record.Reset()
+				}
+				batchCnt++
 				batchLog.Write(line)
-				if eof || batchCnt >= maxBatchCnt {
-					w.ResChan <- FileContent{FilePath: filePath, Content: batchLog.Bytes(), EOF: eof}
-					batchLog.Reset()
+				batchLog.WriteByte('\n')
+				tooLarge := w.maxBatchBytes > 0 && int64(batchLog.Len()) >= w.maxBatchBytes
+				if eof || batchCnt >= maxBatchCnt || tooLarge {
+					sendStatus := StatusContinue
+					if eof {
+						sendStatus = StatusComplete
+					}
+					start, end := span.take()
+					// 读取完毕时立即保存游标, 否则已删除的文件可能被当作未读完
+					deliver(FileContent{FilePath: filePath, Pattern: cfg.pattern, Profile: cfg.profile, Tags: cfg.tags, Content: flushSafeUTF8(batchLog, eof), EOF: eof, Status: sendStatus, Timestamp: time.Now(), LineStart: start, LineEnd: end}, eof)
 					batchCnt = 0
 					sendTimer.Reset(maxSendDur)
-
-					// 保存光标信息到配置文件
-					err = saveCursor(cursorFW, offset)
-					if err != nil {
-						// 处理保存光标信息失败的情况
-						fmt.Println("Error saving cursor to config:", err)
-					}
 				}
 				if eof {
-					fmt.Printf("%s 文件读取完毕, 开始清理...\n", filePath)
+					// 确认模式下全部内容确认后才算读取完毕, 被停止时不删除文件, 下次监听时重新发送未确认的内容
+					if dropped || !waitAcks() {
+						return nil
+					}
+					completed = true
+					w.fileCompleted(dirPath, filePath)
+					if !cfg.removeAfterComplete {
+						w.info("文件读取完毕", slog.String("file", filePath))
+						return
+					}
+					w.info("文件读取完毕, 开始清理...", slog.String("file", filePath))
 					if err = os.Remove(filePath); err != nil {
-						fmt.Printf("删除log文件失败: %v\n", err)
+						w.errorf("删除log文件失败: %w", err)
 						return
 					}
-					if err = os.Remove(cursorFile); err != nil {
-						fmt.Printf("删除cursor文件失败: %v\n", err)
+					if err = w.cursors().Delete(filePath); err != nil {
+						w.errorf("删除游标失败: %w", err)
 						return
 					}
-					fmt.Printf("%s '.log'、'.cursor'文件清理完毕\n", strings.TrimSuffix(filePath, ".log"))
+					w.info("文件及游标清理完毕", slog.String("file", filePath))
 					return
 				}
 			}
-			if scanner.Err() != nil {
-				fmt.Printf("扫描文件(%s)时发生错误: %v\n", filePath, err)
+			// 读取出错(如单行超过最大长度)后无法确定下一行的起始位置, 不再继续读取
+			if err := scanner.Err(); err != nil {
+				finish(StatusError)
+				return fmt.Errorf("扫描文件(%s)时发生错误: %w", filePath, err)
+			}
+			if !rotating {
+				continue
+			}
+			batchLog.Write(record.Bytes())
+			record.Reset()
+			if !w.waitRecreated(ctx, filePath) {
+				finish(StatusRemoved)
+				return nil
+			}
+			// 新文件的游标会被重置, 切换前需等待旧文件已发送的内容全部确认
+			if !waitAcks() {
+				return nil
 			}
+			// 新文件从头读取, 旧文件的剩余内容与轮转标记一起发送
+			next, err := w.reopenRotated(filePath)
+			if err != nil {
+				return err
+			}
+			fr.Close()
+			fr = next
+			offset = fr.offset
+			saver.discard()
+			start, end := span.take()
+			deliver(FileContent{FilePath: filePath, Pattern: cfg.pattern, Profile: cfg.profile, Tags: cfg.tags, Content: flushSafeUTF8(batchLog, true), Rotated: true, Timestamp: time.Now(), LineStart: start, LineEnd: end}, false)
+			span = lineSpan{line: fr.line}
+			batchCnt = 0
+			w.updateFile(status, offset)
+			w.info("文件已轮转, 从新文件开头继续读取", slog.String("file", filePath))
+			watchEvents()
+		case <-deadlineC:
+			w.info("已到达监听截止时间, 不再监控", slog.String("file", filePath), slog.Time("deadline", deadline))
+			finish(StatusDeadlineExceeded)
+			completed = true
+			return nil
 		case <-sendTimer.C:
-			if batchLog.Len() > 0 {
-				w.ResChan <- FileContent{FilePath: filePath, Content: batchLog.Bytes(), EOF: false}
-				batchLog.Reset()
+			if paused, _ := w.pauseState(); paused {
+				sendTimer.Reset(maxSendDur)
+				continue
+			}
+			if content := flushSafeUTF8(batchLog, false); len(content) > 0 {
+				start, end := span.take()
+				deliver(FileContent{FilePath: filePath, Pattern: cfg.pattern, Profile: cfg.profile, Tags: cfg.tags, Content: content, EOF: false, Timestamp: time.Now(), LineStart: start, LineEnd: end}, false)
 				batchCnt = 0
-
-				// 保存光标信息到配置文件
-				err = saveCursor(cursorFW, offset)
-				if err != nil {
-					// 处理保存光标信息失败的情况
-					fmt.Println("Error saving cursor to config:", err)
-					continue
-				}
+			} else if err = saver.flushDue(); err != nil {
+				w.handleErr(err)
 			}
 
 			if longTimeNoUpdate {
-				fmt.Printf("%s 长时间(%v)未更新, 认为文件读取完毕, 不再监控\n", filePath, maxNoUpdateTime)
+				w.info("文件长时间未更新, 认为文件读取完毕, 不再监控", slog.String("file", filePath), slog.Duration("timeout", cfg.maxNoUpdateTime))
+				finish(StatusTimeout)
+				completed = true
 				return nil
 			}
 			sendTimer.Reset(maxSendDur)
@@ -328,73 +1583,299 @@ func (w *FileWatcher) Watch(filePath string) (err error) {
 	}
 }
 
-func (w *FileWatcher) watchFileEvent(filePath string, scanChan chan bool) {
-	defer fmt.Printf("%s 文件事件监听完成\n", filePath)
-	// 创建一个文件监控器
-	watcher, err := fsnotify.NewWatcher()
+// packContent 设置了压缩时以gzip压缩待发送的内容, 内容为空时不压缩
+func (w *FileWatcher) packContent(c FileContent) FileContent {
+	if !w.compressContent || len(c.Content) == 0 {
+		return c
+	}
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(c.Content); err != nil {
+		w.errorf("压缩内容失败, 以原始内容发送: %w", err)
+		return c
+	}
+	if err := gw.Close(); err != nil {
+		w.errorf("压缩内容失败, 以原始内容发送: %w", err)
+		return c
+	}
+	c.Content, c.Compressed = buf.Bytes(), true
+	return c
+}
+
+// lineSpan 统计已读取的行数及待发送内容的行号范围
+type lineSpan struct {
+	line       int64 // 已读取的行数, 即当前行的行号
+	start, end int64 // 待发送内容的首行与末行行号, 没有待发送内容时为0
+}
+
+// keep 当前行加入待发送内容
+func (s *lineSpan) keep() {
+	if s.start == 0 {
+		s.start = s.line
+	}
+	s.end = s.line
+}
+
+// take 取出待发送内容的行号范围, 之后的内容重新开始计算
+func (s *lineSpan) take() (int64, int64) {
+	start, end := s.start, s.end
+	s.start, s.end = 0, 0
+	return start, end
+}
+
+// flushSafeUTF8 取出缓冲区中待发送内容的副本. final为false时保留末尾不完整的UTF-8字符,
+// 留在缓冲区中与下一批内容拼接, 避免一个字符被拆分到两次发送中
+func flushSafeUTF8(buf *bytes.Buffer, final bool) []byte {
+	b := buf.Bytes()
+	n := len(b)
+	if !final {
+		// 从末尾向前找到最后一个字符的起始字节, 该字符不完整时不发送
+		for i := n - 1; i >= 0 && i >= n-utf8.UTFMax; i-- {
+			if utf8.RuneStart(b[i]) {
+				if !utf8.FullRune(b[i:]) {
+					n = i
+				}
+				break
+			}
+		}
+	}
+	content := bytes.Clone(buf.Next(n))
+	if buf.Len() == 0 {
+		buf.Reset()
+	}
+	return content
+}
+
+// origin为开始监听时的文件, 文件路径指向其他文件时通知statusReplaced; replaced用于接收目录中同名文件被创建的通知.
+// 出错时先将错误写入errChan再通知StatusError, 由Watch返回该错误
+func (w *FileWatcher) watchFileEvent(ctx context.Context, filePath string, origin os.FileInfo, replaced <-chan struct{}, maxNoUpdateTime time.Duration, scanChan chan ContentStatus, errChan chan<- error) {
+	defer w.info("文件事件监听完成", slog.String("file", filePath))
+	// Watch退出后不再读取scanChan, 发送时需同时关注ctx, 避免阻塞
+	notify := func(status ContentStatus) {
+		select {
+		case scanChan <- status:
+		case <-ctx.Done():
+		}
+	}
+	fail := func(err error) {
+		select {
+		case errChan <- err:
+		default:
+		}
+		notify(StatusError)
+	}
+	// 订阅共用监控器中该文件的事件
+	path := w.resolvePath(filePath)
+	sub, err := w.events.subscribe(path)
 	if err != nil {
-		fmt.Printf("%s 文件创建监控器失败: %v\n", err, filePath)
-		scanChan <- false
+		fail(fmt.Errorf("文件(%s)添加到监控器失败: %w", filePath, err))
 		return
 	}
-	defer watcher.Close()
-	watcher.Add(filePath)
+	defer w.events.unsubscribe(path, sub)
+	// 文件被删除、覆盖后路径可能已指向其他文件, 此时旧文件不会再有内容
+	isReplaced := func() bool {
+		if origin == nil {
+			return false
+		}
+		info, err := os.Stat(path)
+		return err == nil && !os.SameFile(origin, info)
+	}
 
-	go func() {
-		// 为了立即读一次, 直接发一个Event触发下
-		watcher.Events <- fsnotify.Event{Name: "Read Now", Op: fsnotify.Write}
-	}()
+	// 为了立即读一次, 直接触发一次扫描
+	scanChan <- StatusContinue
 
-	timer := time.NewTicker(w.maxNoUpdateTime)
+	timer := time.NewTicker(maxNoUpdateTime)
 	defer timer.Stop()
 
 	// 监听文件变化事件
 	for {
+		_, resume := w.pauseState()
 		select {
-		case event, ok := <-watcher.Events:
-			if !ok {
-				fmt.Printf("%s watcher.Events被关闭了\n", filePath)
-				scanChan <- false
+		case <-ctx.Done():
+			return
+		case <-resume:
+			// 暂停期间不计算未更新时长, 恢复后重新计时
+			timer.Reset(maxNoUpdateTime)
+		case <-replaced:
+			if isReplaced() {
+				w.info("文件已被替换", slog.String("file", filePath))
+				notify(statusReplaced)
 				return
 			}
+		case event := <-sub.events:
 			// 只关注Write事件，表示文件有新内容
 			if event.Op&fsnotify.Write == fsnotify.Write {
 				if len(scanChan) <= 1 {
-					scanChan <- true
+					scanChan <- StatusContinue
 				}
-				timer.Reset(w.maxNoUpdateTime)
+				timer.Reset(maxNoUpdateTime)
+			}
+			// 支持轮转时, 重命名(如app.log -> app.log.1)同样视为旧文件结束
+			rotated := w.rotationGrace > 0 && event.Op&fsnotify.Rename == fsnotify.Rename
+			if event.Op&fsnotify.Remove == fsnotify.Remove || rotated {
+				w.info("文件读取完毕", slog.String("file", filePath))
+				notify(StatusRemoved)
+				return
 			}
-			if event.Op&fsnotify.Remove == fsnotify.Remove {
-				fmt.Printf("%s 文件读取完毕\n", filePath)
-				scanChan <- false
+			// 文件被覆盖时旧文件的链接数变化(Chmod事件)
+			if event.Op&(fsnotify.Chmod|fsnotify.Rename) != 0 && isReplaced() {
+				w.info("文件已被替换", slog.String("file", filePath))
+				notify(statusReplaced)
 				return
 			}
-		case e := <-watcher.Errors:
-			fmt.Printf("watcher.Errors: %v\n", e)
-			scanChan <- false
+		case e := <-sub.errs:
+			fail(fmt.Errorf("watcher.Errors: %w", e))
 			return
 		case <-timer.C:
-			fmt.Printf("%s 长时间(%v)未更新, 认为文件读取完毕, 不再监控\n", filePath, w.maxNoUpdateTime)
-			scanChan <- false
+			if paused, _ := w.pauseState(); paused {
+				continue
+			}
+			w.info("文件长时间未更新, 认为文件读取完毕, 不再监控", slog.String("file", filePath), slog.Duration("timeout", maxNoUpdateTime))
+			notify(StatusTimeout)
 			return
 		}
 	}
 }
 
-func readCursor(cursorPath string) (int64, error) {
+func readCursorFile(cursorPath string) (Cursor, error) {
 	data, err := os.ReadFile(cursorPath)
 	if err != nil {
-		return 0, err
+		return Cursor{}, err
+	}
+	data = bytes.TrimSpace(data)
+	// 游标文件总是先写临时文件再重命名, 为空说明写入时机器崩溃(未落盘)或被外部截断
+	if len(data) == 0 {
+		return Cursor{}, errors.New("游标文件为空, 可能在写入时中断")
+	}
+	var c Cursor
+	if data[0] == '{' {
+		if err = json.Unmarshal(data, &c); err != nil {
+			return Cursor{}, err
+		}
+	} else if c, err = parseLegacyCursor(string(data)); err != nil {
+		return Cursor{}, err
 	}
-	return strconv.ParseInt(string(data), 10, 64)
+	if c.Offset < 0 || c.Line < 0 {
+		return Cursor{}, fmt.Errorf("游标不能小于0, 当前: %d %d", c.Offset, c.Line)
+	}
+	return c, nil
 }
 
-func saveCursor(f *os.File, offset int64) error {
-	if _, err := f.Seek(0, io.SeekStart); err != nil {
+// parseLegacyCursor 解析旧版本的游标, 格式为"偏移量"或"偏移量 行数"
+func parseLegacyCursor(data string) (Cursor, error) {
+	fields := strings.Fields(data)
+	if len(fields) > 2 {
+		return Cursor{}, fmt.Errorf("游标格式错误: %q", data)
+	}
+	var c Cursor
+	var err error
+	if c.Offset, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+		return Cursor{}, err
+	}
+	if len(fields) == 2 {
+		if c.Line, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return Cursor{}, err
+		}
+	}
+	return c, nil
+}
+
+// writeCursorFile 写入游标文件. sync为true时写入后落盘, 首次创建游标文件时还会对所在目录落盘,
+// 保证机器崩溃后游标不丢失
+func writeCursorFile(cursorFile string, c Cursor, sync bool) error {
+	data, err := json.Marshal(c)
+	if err != nil {
 		return err
 	}
-	_, err := f.WriteString(fmt.Sprintf("%d", offset))
-	return err
+	// 先写入临时文件, 再重命名覆盖, 避免写入中途崩溃导致游标文件损坏.
+	// 临时文件同样以.cursor结尾, 不会被当作监控文件
+	tmpFile := strings.TrimSuffix(cursorFile, CursorFileSuffix) + ".tmp" + CursorFileSuffix
+	f, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	created := false
+	if sync {
+		_, err := os.Stat(cursorFile)
+		created = errors.Is(err, os.ErrNotExist)
+	}
+	if err := os.Rename(tmpFile, cursorFile); err != nil {
+		return err
+	}
+	if created {
+		return syncDir(filepath.Dir(cursorFile))
+	}
+	return nil
+}
+
+// addDirTree 将文件夹及其下所有子文件夹、符号链接添加到监控器, 超出监控深度(相对于root)的子文件夹不添加
+func (w *FileWatcher) addDirTree(watcher *fsnotify.Watcher, root, dirPath string) error {
+	return filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// 只添加文件夹和符号链接到监控器
+		if info.IsDir() || (info.Mode()&os.ModeSymlink != 0) {
+			if !w.dirAllowed(root, path) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if err := watcher.Add(path); err != nil {
+				return fmt.Errorf("添加文件夹到监控器时失败: %w", wrapWatchLimit(path, err))
+			}
+		}
+		return nil
+	})
+}
+
+// dirAllowed 判断文件夹是否需要监控: 不能被排除或隐藏(设置了忽略隐藏文件时), 且在监控深度内.
+// 深度为相对于监控根文件夹的层级, 符号链接文件夹算作一层
+func (w *FileWatcher) dirAllowed(root, dirPath string) bool {
+	rel, err := filepath.Rel(root, dirPath)
+	if err != nil || rel == "." {
+		return true
+	}
+	if !w.recursive {
+		return false
+	}
+	if w.excludeDirRe != nil && w.excludeDirRe.MatchString(filepath.ToSlash(rel)) {
+		return false
+	}
+	if w.ignoreHidden && isHidden(root, dirPath) {
+		return false
+	}
+	if w.maxDepth <= 0 {
+		return true
+	}
+	depth := len(strings.Split(filepath.Clean(rel), string(filepath.Separator)))
+	return depth <= w.maxDepth
+}
+
+// resolvePath 设置了跟随符号链接时返回链接指向的真实路径, 否则原样返回
+func (w *FileWatcher) resolvePath(filePath string) string {
+	if !w.followSymlinks {
+		return filePath
+	}
+	realPath, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return filePath
+	}
+	return realPath
 }
 
 func isDirectory(path string) (bool, error) {
@@ -0,0 +1,711 @@
+package filewatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestWatchAfterStop(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(filePath, []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(WithDir(dir), WithInMemoryCursors())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 游标超过文件大小, 开始读取时会发送截断通知
+	if err := w.cursors().Save(filePath, Cursor{Offset: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Watch(context.Background(), filePath); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Stop之后Watch应返回ErrStopped, 实际: %v", err)
+	}
+}
+
+func TestOnFileCompleteOnIdleTimeout(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(filePath, []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	completed := make(chan error, 1)
+	w, err := NewWatcher(WithDir(dir), WithInMemoryCursors(), WithMaxNoUpdateTime(500*time.Millisecond),
+		WithOnFileComplete(func(_ string, err error) { completed <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- w.Watch(context.Background(), filePath) }()
+	var last FileContent
+	for last.Status == StatusContinue {
+		select {
+		case last = <-w.ResChan:
+		case <-time.After(5 * time.Second):
+			t.Fatal("等待超时通知超时")
+		}
+	}
+	if last.Status != StatusTimeout {
+		t.Fatalf("期望StatusTimeout, 实际: %v", last.Status)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-completed:
+		if err != nil {
+			t.Fatalf("OnFileComplete收到错误: %v", err)
+		}
+	default:
+		t.Fatal("长时间未更新后未调用OnFileComplete")
+	}
+}
+
+func TestOnFileCompleteOnOpenError(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "missing.log")
+	var got error
+	w, err := NewWatcher(WithDir(dir), WithInMemoryCursors(), WithOnFileComplete(func(_ string, err error) { got = err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Watch(context.Background(), filePath)
+	if err == nil {
+		t.Fatal("打开不存在的文件应返回错误")
+	}
+	if got == nil || got.Error() != err.Error() {
+		t.Fatalf("OnFileComplete应收到打开文件的错误, 实际: %v", got)
+	}
+}
+
+func TestOnFileCompleteOnEventError(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	filePath := filepath.Join(sub, "a.log")
+	if err := os.WriteFile(filePath, []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	completed := make(chan error, 1)
+	w, err := NewWatcher(WithDir(dir), WithInMemoryCursors(), WithPollingInterval(20*time.Millisecond),
+		WithOnFileComplete(func(_ string, err error) { completed <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range w.ResChan {
+		}
+	}()
+	done := make(chan error, 1)
+	go func() { done <- w.Watch(context.Background(), filePath) }()
+	time.Sleep(100 * time.Millisecond)
+	// 文件夹被替换为普通文件后查询文件信息返回ENOTDIR, 而不是文件不存在
+	if err := os.RemoveAll(sub); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sub, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var watchErr error
+	select {
+	case watchErr = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待Watch退出超时")
+	}
+	if watchErr == nil {
+		t.Fatal("文件事件监听出错时Watch应返回错误")
+	}
+	if err := <-completed; err == nil || err.Error() != watchErr.Error() {
+		t.Fatalf("OnFileComplete应收到最终的错误, 实际: %v", err)
+	}
+}
+
+func TestWatchSurvivesEventOverflow(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(filePath, []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var starts atomic.Int32
+	w, err := NewWatcher(WithDir(dir), WithInMemoryCursors(), WithFlushInterval(50*time.Millisecond),
+		WithOnFileStart(func(string) { starts.Add(1) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready := make(chan error, 1)
+	go w.start(context.Background(), ready)
+	if err := <-ready; err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	expect := func(line string) {
+		t.Helper()
+		for {
+			select {
+			case c := <-w.ResChan:
+				if string(c.Content) == line {
+					return
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("未收到内容: %q", line)
+			}
+		}
+	}
+	expect("l1\n")
+
+	w.mu.Lock()
+	old := w.fsWatcher
+	w.mu.Unlock()
+	old.Errors <- fsnotify.ErrEventOverflow
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		w.mu.Lock()
+		restarted := w.fsWatcher != nil && w.fsWatcher != old
+		w.mu.Unlock()
+		if restarted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("事件溢出后监控任务未重启")
+		}
+	}
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("l2\n")
+	f.Close()
+	expect("l2\n")
+	// 文件的监听不因重启而中断
+	if n := starts.Load(); n != 1 {
+		t.Fatalf("文件的监听被重新开始了%d次", n-1)
+	}
+}
+
+func TestNoDuplicateLines(t *testing.T) {
+	dir := t.TempDir()
+	const files, lines = 20, 50
+	// 启动时已存在的文件, Scan与文件事件会同时发现它
+	for i := 0; i < files/2; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.log", i)), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var starts atomic.Int32
+	w, err := NewWatcher(WithDir(dir), WithInMemoryCursors(), WithFlushInterval(50*time.Millisecond),
+		WithOnFileStart(func(string) { starts.Add(1) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready := make(chan error, 1)
+	go w.start(context.Background(), ready)
+	if err := <-ready; err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	// 新建文件后立即追加内容
+	for i := 0; i < files; i++ {
+		f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%02d.log", i)), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < lines; j++ {
+			fmt.Fprintf(f, "%02d-%03d\n", i, j)
+		}
+		f.Close()
+	}
+	seen := make(map[string]int)
+	for total := 0; total < files*lines; {
+		select {
+		case c := <-w.ResChan:
+			for _, line := range strings.SplitAfter(string(c.Content), "\n") {
+				if line == "" {
+					continue
+				}
+				seen[line]++
+				total++
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("只收到%d行, 期望%d行", total, files*lines)
+		}
+	}
+	// 再等待一段时间, 确认没有重复的内容
+	select {
+	case c := <-w.ResChan:
+		t.Fatalf("收到多余的内容: %q", c.Content)
+	case <-time.After(300 * time.Millisecond):
+	}
+	for line, n := range seen {
+		if n != 1 {
+			t.Errorf("%q 收到%d次", line, n)
+		}
+	}
+	if n := starts.Load(); n != files {
+		t.Errorf("文件被监听了%d次, 期望%d次", n, files)
+	}
+}
+
+func TestWatchSameFileTwice(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(filePath, []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(WithDir(dir), WithInMemoryCursors(), WithFlushInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Watch(ctx, filePath) }()
+	<-w.ResChan
+	// 同一文件的另一种写法也视为同一文件
+	second, cancelSecond := context.WithTimeout(ctx, time.Second)
+	defer cancelSecond()
+	if err := w.Watch(second, filepath.Join(dir, ".", "a.log")); !errors.Is(err, ErrFileWatching) {
+		t.Fatalf("重复监听应返回ErrFileWatching, 实际: %v", err)
+	}
+	cancel()
+	<-done
+	// 监听结束后可以再次监听
+	if !w.claimFile(filePath) {
+		t.Fatal("监听结束后文件仍被标记为正在读取")
+	}
+}
+
+func TestCloneCursorStore(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	w, err := NewWatcher(WithDir(dir), WithInMemoryCursors())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.cursors().Save(filePath, Cursor{Offset: 10}); err != nil {
+		t.Fatal(err)
+	}
+	// 内存游标不共用, 克隆之间互不影响
+	clone := w.Clone()
+	if _, err := clone.cursors().Load(filePath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("克隆不应读到原watcher的内存游标, 实际: %v", err)
+	}
+	if err := clone.cursors().Save(filePath, Cursor{Offset: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := w.cursors().Load(filePath); err != nil || c.Offset != 10 {
+		t.Fatalf("原watcher的游标被克隆修改: %+v, %v", c, err)
+	}
+
+	// 显式设置的存储仍共用
+	store := &recordingStore{memoryCursorStore: newMemoryCursorStore()}
+	w, err = NewWatcher(WithDir(dir), WithCursorStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Clone().cursors() != CursorStore(store) {
+		t.Fatal("克隆应共用WithCursorStore设置的存储")
+	}
+}
+
+func TestSymlinksToSameFile(t *testing.T) {
+	dir := t.TempDir()
+	realPath := filepath.Join(t.TempDir(), "real.log")
+	if err := os.WriteFile(realPath, []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	links := []string{filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")}
+	for _, link := range links {
+		if err := os.Symlink(realPath, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := NewWatcher(WithDir(dir), WithInMemoryCursors(), WithFollowSymlinks(true), WithFlushInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, link := range links {
+		go w.Watch(ctx, link)
+	}
+	received := func(line string) map[string]bool {
+		t.Helper()
+		got := make(map[string]bool)
+		for len(got) < len(links) {
+			select {
+			case c := <-w.ResChan:
+				if string(c.Content) == line {
+					got[c.FilePath] = true
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%q 只被%d个链接收到: %v", line, len(got), got)
+			}
+		}
+		return got
+	}
+	received("l1\n")
+	// 两个链接解析为同一路径, 新内容的事件需分发给两者
+	f, err := os.OpenFile(realPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("l2\n")
+	f.Close()
+	received("l2\n")
+}
+
+func TestCustomMaxNoUpdateTime(t *testing.T) {
+	// watchUntilDone 监听文件直到收到非StatusContinue的状态, 返回该状态与耗时
+	watchUntilDone := func(w *FileWatcher, filePath string) (ContentStatus, time.Duration) {
+		t.Helper()
+		begin := time.Now()
+		go w.Watch(context.Background(), filePath)
+		for {
+			select {
+			case c := <-w.ResChan:
+				if c.Status != StatusContinue {
+					return c.Status, time.Since(begin)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("未按设置的时长结束监听")
+			}
+		}
+	}
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(filePath, []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(WithDir(dir), WithInMemoryCursors(), WithFlushInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetMaxNoUpdateTime(300 * time.Millisecond)
+	status, elapsed := watchUntilDone(w, filePath)
+	if status != StatusTimeout || elapsed < 300*time.Millisecond {
+		t.Fatalf("期望%v后StatusTimeout, 实际%v后%v", 300*time.Millisecond, elapsed, status)
+	}
+
+	// 修改时间早于设置的时长时, 读取现有内容后立即结束
+	stalePath := filepath.Join(dir, "stale.log")
+	if err := os.WriteFile(stalePath, []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(stalePath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	w.SetMaxNoUpdateTime(30 * time.Minute)
+	if status, _ := watchUntilDone(w, stalePath); status != StatusTimeout {
+		t.Fatalf("期望StatusTimeout, 实际: %v", status)
+	}
+}
+
+func TestSettersWhileWatching(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWatcher(WithDir(dir), WithInMemoryCursors(), WithFlushInterval(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready := make(chan error, 1)
+	go w.start(context.Background(), ready)
+	if err := <-ready; err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range w.ResChan {
+		}
+	}()
+	if !w.Watching() {
+		t.Fatal("Start之后Watching应为true")
+	}
+
+	// 监控任务读取配置的同时并发调用各Set方法, 由-race检查数据竞争
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for name, err := range map[string]error{
+					"SetFileRegexp":          w.SetFileRegexp(`\.txt$`),
+					"SetWatchDir":            w.SetWatchDir(filepath.Join(dir, "other")),
+					"SetCompleteMarker":      w.SetCompleteMarker("DONE"),
+					"SetMaxNoUpdateTime":     w.SetMaxNoUpdateTime(time.Second),
+					"SetRemoveAfterComplete": w.SetRemoveAfterComplete(true),
+				} {
+					if !errors.Is(err, ErrWatching) {
+						t.Errorf("%s() = %v, want ErrWatching", name, err)
+					}
+				}
+				w.Watching()
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.log", i)), []byte("l1\nLOG_COMPLETE\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	// 运行时的修改均未生效, 停止后可以修改
+	if w.completeMarker != DefaultCompleteMarker || w.removeAfterComplete {
+		t.Error("运行中的修改不应生效")
+	}
+	if err := w.SetFileRegexp(`\.txt$`); err != nil {
+		t.Fatalf("停止后SetFileRegexp() = %v", err)
+	}
+}
+
+func TestSettersWhileDirectWatch(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(filePath, []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(WithDir(dir), WithInMemoryCursors(), WithFlushInterval(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Watch(ctx, filePath) }()
+	<-w.ResChan
+	// 未调用Start, 但Watch读取配置期间同样不允许修改
+	if err := w.SetCompleteMarker("DONE"); !errors.Is(err, ErrWatching) {
+		t.Errorf("SetCompleteMarker() = %v, want ErrWatching", err)
+	}
+	if err := w.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetCompleteMarker("DONE"); err != nil {
+		t.Errorf("Watch结束后SetCompleteMarker() = %v", err)
+	}
+}
+
+func TestFileStatusPathForms(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(filePath, []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := startWatcher(t, WithDir(dir))
+	receiveFiles(t, w, []string{filePath}, 50*time.Millisecond)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一文件的不同写法均能查到
+	for _, p := range []string{filePath, dir + "/./a.log", rel} {
+		st, ok := w.FileStatus(p)
+		if !ok {
+			t.Errorf("FileStatus(%s)未查到正在监听的文件", p)
+			continue
+		}
+		if st.Offset != 3 {
+			t.Errorf("FileStatus(%s).Offset = %d, want 3", p, st.Offset)
+		}
+	}
+}
+
+func TestStopWithIdleConsumer(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(filePath, []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := startWatcher(t, WithDir(dir))
+	receiveFiles(t, w, []string{filePath}, 50*time.Millisecond)
+	// 消费者不再读取, 之后的内容无法发送
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("l2\n")
+	f.Close()
+	time.Sleep(200 * time.Millisecond)
+	stopped := make(chan error, 1)
+	go func() { stopped <- w.Stop() }()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("消费者停止读取后Stop被阻塞")
+	}
+	// 未发送的内容在再次Start后重新读取
+	ready := make(chan error, 1)
+	go w.start(context.Background(), ready)
+	if err := <-ready; err != nil {
+		t.Fatal(err)
+	}
+	if got := receiveFiles(t, w, []string{filePath}, 100*time.Millisecond); got[filePath] != "l2\n" {
+		t.Fatalf("再次Start后应收到未发送的内容, 实际: %q", got[filePath])
+	}
+}
+
+func TestRestartAfterStopTimeout(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(filePath, []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := startWatcher(t, WithDir(dir), WithStopTimeout(time.Millisecond))
+	// 停止超时后立即再次Start, 仍在退出的协程与新的结果通道之间不能有数据竞争
+	for i := 0; i < 3; i++ {
+		w.Stop()
+		for {
+			ready := make(chan error, 1)
+			go w.start(context.Background(), ready)
+			err := <-ready
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, ErrAlreadyWatching) {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for c := range w.GetResChan() {
+		if string(c.Content) == "l1\n" {
+			break
+		}
+	}
+}
+
+func TestDrainOnceAfterStop(t *testing.T) {
+	dir := t.TempDir()
+	w := startWatcher(t, WithDir(dir))
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	for w.Watching() {
+		time.Sleep(time.Millisecond)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.log"), []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 结果通道已关闭, 不能再发送内容
+	if err := w.DrainOnce(context.Background()); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Stop之后DrainOnce应返回ErrStopped, 实际: %v", err)
+	}
+}
+
+func TestStopDuringDrainOnce(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.log"), []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(WithDir(dir), WithInMemoryCursors())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有消费者, DrainOnce阻塞在发送上, Stop需等待其退出后再关闭结果通道
+	done := make(chan error, 1)
+	go func() { done <- w.DrainOnce(context.Background()) }()
+	time.Sleep(100 * time.Millisecond)
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, ErrStopped) {
+		t.Fatalf("DrainOnce() = %v, want ErrStopped", err)
+	}
+	if _, ok := <-w.ResChan; ok {
+		t.Fatal("结果通道应已关闭")
+	}
+}
+
+func TestRestartKeepsResChan(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(filePath, []byte("l1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(WithDir(dir), WithInMemoryCursors(), WithFlushInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := w.StartAsync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	// 消费者只获取一次结果通道
+	lines := make(chan string, 10)
+	go func() {
+		defer close(lines)
+		for c := range w.GetResChan() {
+			if len(c.Content) > 0 {
+				lines <- string(c.Content)
+			}
+		}
+	}()
+	expect := func(line string) {
+		t.Helper()
+		select {
+		case got, ok := <-lines:
+			if !ok {
+				t.Fatalf("结果通道已关闭, 未收到%q", line)
+			}
+			if got != line {
+				t.Fatalf("收到%q, 期望%q", got, line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("未收到%q", line)
+		}
+	}
+	expect("l1\n")
+
+	// 监控器出错使监控任务退出
+	w.mu.Lock()
+	fsWatcher := w.fsWatcher
+	w.mu.Unlock()
+	fsWatcher.Errors <- errors.New("injected")
+	<-r.Done()
+	if err := w.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("l2\n")
+	f.Close()
+	// 已发送的内容不重复发送, 新内容仍从原结果通道收到
+	expect("l2\n")
+}
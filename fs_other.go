@@ -0,0 +1,15 @@
+//go:build !unix
+
+package filewatch
+
+import "os"
+
+// fileID 当前平台无法获取inode, 只依靠文件开头内容的校验和判断文件是否被替换
+func fileID(info os.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
+
+// syncDir 当前平台不支持对目录落盘, 忽略
+func syncDir(dirPath string) error {
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package filewatch
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID 获取文件所在设备号及inode, 用于判断文件是否被替换
+func fileID(info os.FileInfo) (dev, ino uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(st.Dev), uint64(st.Ino), true
+}
+
+// syncDir 将目录项的变更(如新建文件)落盘
+func syncDir(dirPath string) error {
+	d, err := os.Open(dirPath)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,54 @@
+package filewatch
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// WithFileGlob 以glob模式代替正则表达式选择监控的文件, 支持*、?、[...]以及匹配任意层文件夹的**.
+// 不含/的模式(如*.log、app-??.log)匹配文件名, 含/的模式(如**/access.log)匹配相对于监控文件夹的路径.
+// 不能与WithFileRegexp同时设置, 否则Validate时返回ErrGlobAndRegexp
+func WithFileGlob(pattern string) Option {
+	return func(w *FileWatcher) error {
+		for _, part := range strings.Split(pattern, "/") {
+			if _, err := filepath.Match(part, ""); err != nil {
+				return fmt.Errorf("%w: %s: %v", ErrInvalidGlob, pattern, err)
+			}
+		}
+		w.fileGlob = pattern
+		return nil
+	}
+}
+
+// matchGlob 判断文件是否匹配glob模式, rel为相对于监控文件夹的路径
+func matchGlob(pattern, rel string) bool {
+	rel = filepath.ToSlash(rel)
+	if !strings.Contains(pattern, "/") {
+		ok, _ := filepath.Match(pattern, rel[strings.LastIndex(rel, "/")+1:])
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments 逐层匹配路径, **可匹配零或多层文件夹
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -1,7 +1,11 @@
 module github.com/ChangSZ/filewatch
 
-go 1.21.0
+go 1.22
 
-require github.com/fsnotify/fsnotify v1.7.0
+require (
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/klauspost/compress v1.18.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
-require golang.org/x/sys v0.4.0 // indirect
+require golang.org/x/sys v0.22.0 // indirect
@@ -0,0 +1,58 @@
+package filewatch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLineFilterDropsEmptyLines(t *testing.T) {
+	dir := t.TempDir()
+	data := "l1\n\nl2\n\n\nl3\n"
+	filePath := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(filePath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := &recordingStore{memoryCursorStore: newMemoryCursorStore()}
+	content, errs := drainFile(t, dir, WithCursorStore(store), WithLineFilter(func(line []byte) bool { return len(line) > 0 }))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if content != "l1\nl2\nl3\n" {
+		t.Fatalf("content = %q, want %q", content, "l1\nl2\nl3\n")
+	}
+	// 被过滤的行同样推进游标
+	c, err := store.Load(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Offset != int64(len(data)) || c.Line != 6 {
+		t.Fatalf("cursor = %+v, want offset %d line 6", c, len(data))
+	}
+}
+
+func TestLineTransformerTag(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.log"), []byte("l1\n\nl2\nLOG_COMPLETE\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 转换在过滤之后进行, 结束标记行不受影响
+	content, errs := drainFile(t, dir, WithInMemoryCursors(),
+		WithLineFilter(func(line []byte) bool { return len(line) > 0 }),
+		WithLineTransformer(func(line []byte) []byte { return append([]byte("[app] "), line...) }))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if want := "[app] l1\n[app] l2\nLOG_COMPLETE\n"; content != want {
+		t.Fatalf("content = %q, want %q", content, want)
+	}
+
+	// nil表示不转换
+	content, errs = drainFile(t, dir, WithInMemoryCursors(), WithLineTransformer(nil))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if want := "l1\n\nl2\nLOG_COMPLETE\n"; content != want {
+		t.Fatalf("content = %q, want %q", content, want)
+	}
+}
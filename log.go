@@ -0,0 +1,59 @@
+package filewatch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// slogger 返回输出日志使用的logger, 未设置时使用slog.Default()
+func (w *FileWatcher) slogger() *slog.Logger {
+	if w.logger != nil {
+		return w.logger
+	}
+	return slog.Default()
+}
+
+// log 以结构化的方式输出日志, 设置了LogHandler时格式化为"msg key=value ..."后交由其处理
+func (w *FileWatcher) log(level slog.Level, msg string, args ...any) {
+	if w.logHandler == nil {
+		w.slogger().Log(context.Background(), level, msg, args...)
+		return
+	}
+	r := slog.NewRecord(time.Time{}, level, msg, 0)
+	r.Add(args...)
+	var b strings.Builder
+	b.WriteString(msg)
+	r.Attrs(func(a slog.Attr) bool {
+		b.WriteByte(' ')
+		b.WriteString(a.String())
+		return true
+	})
+	w.logHandler(b.String())
+}
+
+// info 输出提示信息
+func (w *FileWatcher) info(msg string, args ...any) {
+	w.log(slog.LevelInfo, msg, args...)
+}
+
+// warn 输出警告信息
+func (w *FileWatcher) warn(msg string, args ...any) {
+	w.log(slog.LevelWarn, msg, args...)
+}
+
+// errorf 上报错误, 未设置ErrorHandler时以Error级别输出日志
+func (w *FileWatcher) errorf(format string, args ...any) {
+	w.handleErr(fmt.Errorf(format, args...))
+}
+
+// handleErr 上报错误, 未设置ErrorHandler时以Error级别输出日志
+func (w *FileWatcher) handleErr(err error) {
+	if w.errorHandler != nil {
+		w.errorHandler(err)
+		return
+	}
+	w.slogger().Error(err.Error())
+}
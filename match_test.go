@@ -0,0 +1,88 @@
+package filewatch
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExcludeRegexp(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWatcher(WithDir(dir), WithFileRegexp(`\.log$`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetExcludeRegexps([]string{`debug`, `^tmp-`}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetMatchBaseName(true); err != nil {
+		t.Fatal(err)
+	}
+	// 匹配包含的表达式且不匹配任何排除的表达式
+	for name, want := range map[string]bool{
+		"app.log":       true,
+		"app.txt":       false,
+		"app-debug.log": false,
+		"tmp-app.log":   false,
+	} {
+		if got := w.matchFile(dir, filepath.Join(dir, name)); got != want {
+			t.Errorf("matchFile(%s) = %v, want %v", name, got, want)
+		}
+	}
+	if err := w.SetExcludeRegexp(""); err != nil {
+		t.Fatal(err)
+	}
+	if !w.matchFile(dir, filepath.Join(dir, "app-debug.log")) {
+		t.Error("清空排除的表达式后仍被排除")
+	}
+}
+
+func TestMatchBaseName(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWatcher(WithDir(dir), WithFileRegexp(`^job-\d+\.log$`), WithMatchBaseName(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		filepath.Join(dir, "job-1.log"):                 true,
+		filepath.Join(dir, "2024", "06", "job-2.log"):   true,
+		filepath.Join(dir, "job-1", "app.log"):          false,
+		filepath.Join(dir, "2024", "06", "xjob-3.log"):  false,
+		filepath.Join(dir, "2024", "06", "job-3.log.1"): false,
+	}
+	if filepath.Separator == '\\' {
+		// Windows下两种分隔符均可
+		cases[dir+`\2024\06\job-4.log`] = true
+		cases[dir+`/2024/06/job-5.log`] = true
+	} else {
+		// 其他系统中\是文件名的一部分
+		cases[filepath.Join(dir, `2024\job-6.log`)] = false
+	}
+	for filePath, want := range cases {
+		if got := w.matchFile(dir, filePath); got != want {
+			t.Errorf("matchFile(%s) = %v, want %v", filePath, got, want)
+		}
+	}
+	// 不设置时匹配完整路径, 带^的表达式无法匹配
+	if err := w.SetMatchBaseName(false); err != nil {
+		t.Fatal(err)
+	}
+	if w.matchFile(dir, filepath.Join(dir, "2024", "job-1.log")) {
+		t.Error("匹配完整路径时不应匹配")
+	}
+}
+
+func TestMatchBaseNameScanAndEvents(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "2024", "job-1.log")
+	writeFiles(t, existing, filepath.Join(dir, "2024", "app.log"))
+	w := startWatcher(t, WithDir(dir), WithFileRegexp(`^job-\d+\.log$`), WithMatchBaseName(true))
+	receiveFiles(t, w, []string{existing}, 50*time.Millisecond)
+	// 启动时扫描与文件创建事件使用相同的匹配方式
+	created := filepath.Join(dir, "2024", "06", "job-2.log")
+	writeFiles(t, created, filepath.Join(dir, "2024", "06", "app.log"))
+	got := receiveFiles(t, w, []string{created}, 300*time.Millisecond)
+	if len(got) != 1 {
+		t.Fatalf("只应读取匹配的文件, 实际: %v", got)
+	}
+}
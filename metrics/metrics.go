@@ -0,0 +1,112 @@
+// Package metrics 将filewatch的统计信息以Prometheus指标的形式暴露.
+// 单独作为一个module, 不使用时filewatch不会引入Prometheus依赖
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ChangSZ/filewatch"
+)
+
+const namespace = "filewatch"
+
+// Option RegisterMetrics的可选配置
+type Option func(*config)
+
+type config struct {
+	fileLabel bool
+}
+
+// WithFileLabel 指标在监控文件夹之外再以文件路径为标签.
+// 默认不启用: 文件路径随文件轮转不断产生, 作为标签会使序列数量无限增长, 仅适用于文件数量固定的场景
+func WithFileLabel() Option {
+	return func(c *config) {
+		c.fileLabel = true
+	}
+}
+
+// observer 将统计事件同步到Prometheus指标
+type observer struct {
+	fileLabel      bool
+	linesRead      *prometheus.CounterVec
+	bytesRead      *prometheus.CounterVec
+	filesCompleted *prometheus.CounterVec
+	filesErrored   *prometheus.CounterVec
+	activeFiles    *prometheus.GaugeVec
+}
+
+// RegisterMetrics 向reg注册w的Prometheus指标, 指标默认只以监控文件夹(dir)为标签, 见WithFileLabel; 需在Start之前调用
+func RegisterMetrics(w *filewatch.FileWatcher, reg prometheus.Registerer, opts ...Option) error {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	labels := []string{"dir"}
+	if cfg.fileLabel {
+		labels = append(labels, "file")
+	}
+	o := &observer{
+		fileLabel: cfg.fileLabel,
+		linesRead: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "lines_read_total",
+			Help:      "已读取的行数",
+		}, labels),
+		bytesRead: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bytes_read_total",
+			Help:      "已读取的字节数",
+		}, labels),
+		filesCompleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "files_completed_total",
+			Help:      "读取到结束标记的文件数",
+		}, labels),
+		filesErrored: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "files_errored_total",
+			Help:      "监听出错的文件数",
+		}, labels),
+		activeFiles: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_files",
+			Help:      "正在监听的文件数",
+		}, labels),
+	}
+	for _, c := range []prometheus.Collector{o.linesRead, o.bytesRead, o.filesCompleted, o.filesErrored, o.activeFiles} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return w.SetStatsObserver(o)
+}
+
+// values 获取事件对应的标签值
+func (o *observer) values(dirPath, filePath string) []string {
+	if o.fileLabel {
+		return []string{dirPath, filePath}
+	}
+	return []string{dirPath}
+}
+
+func (o *observer) FileStarted(dirPath, filePath string) {
+	o.activeFiles.WithLabelValues(o.values(dirPath, filePath)...).Inc()
+}
+
+func (o *observer) FileStopped(dirPath, filePath string) {
+	o.activeFiles.WithLabelValues(o.values(dirPath, filePath)...).Dec()
+}
+
+func (o *observer) LineRead(dirPath, filePath string, bytes int) {
+	values := o.values(dirPath, filePath)
+	o.linesRead.WithLabelValues(values...).Inc()
+	o.bytesRead.WithLabelValues(values...).Add(float64(bytes))
+}
+
+func (o *observer) FileCompleted(dirPath, filePath string) {
+	o.filesCompleted.WithLabelValues(o.values(dirPath, filePath)...).Inc()
+}
+
+func (o *observer) FileErrored(dirPath, filePath string) {
+	o.filesErrored.WithLabelValues(o.values(dirPath, filePath)...).Inc()
+}
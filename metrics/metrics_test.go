@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/ChangSZ/filewatch"
+)
+
+func TestMetricsLabeledByDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.log", "b.log", "c.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x\ny\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := filewatch.NewWatcher(filewatch.WithDir(dir), filewatch.WithInMemoryCursors())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	if err := RegisterMetrics(w, reg); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range w.ResChan {
+		}
+	}()
+	if err := w.DrainOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(w.ResChan)
+
+	// 多个文件汇总到同一个序列, 文件结束后active_files回到0
+	n, err := testutil.GatherAndCount(reg, "filewatch_lines_read_total", "filewatch_active_files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("series = %d, want 2", n)
+	}
+	expected := `
+# HELP filewatch_active_files 正在监听的文件数
+# TYPE filewatch_active_files gauge
+filewatch_active_files{dir="` + dir + `"} 0
+# HELP filewatch_lines_read_total 已读取的行数
+# TYPE filewatch_lines_read_total counter
+filewatch_lines_read_total{dir="` + dir + `"} 6
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "filewatch_lines_read_total", "filewatch_active_files"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMetricsFileLabel(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.log", "b.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x\ny\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := filewatch.NewWatcher(filewatch.WithDir(dir), filewatch.WithInMemoryCursors())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	if err := RegisterMetrics(w, reg, WithFileLabel()); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range w.ResChan {
+		}
+	}()
+	if err := w.DrainOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(w.ResChan)
+
+	// 启用后每个文件单独一个序列
+	expected := `
+# HELP filewatch_lines_read_total 已读取的行数
+# TYPE filewatch_lines_read_total counter
+filewatch_lines_read_total{dir="` + dir + `",file="` + filepath.Join(dir, "a.log") + `"} 2
+filewatch_lines_read_total{dir="` + dir + `",file="` + filepath.Join(dir, "b.log") + `"} 2
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "filewatch_lines_read_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,781 @@
+package filewatch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Option watcher的配置项
+type Option func(w *FileWatcher) error
+
+// WithDir 设置监控的文件夹
+func WithDir(dirPath string) Option {
+	return func(w *FileWatcher) error {
+		if dirPath == "" {
+			return errors.New("监控文件夹不能为空")
+		}
+		w.dirPaths = []string{dirPath}
+		return nil
+	}
+}
+
+// WithDirPath 同WithDir
+func WithDirPath(dirPath string) Option {
+	return WithDir(dirPath)
+}
+
+// WithDirs 设置监控的多个文件夹, 文件夹之间不能重复或嵌套
+func WithDirs(dirPaths ...string) Option {
+	return func(w *FileWatcher) error {
+		if len(dirPaths) == 0 {
+			return errors.New("监控文件夹不能为空")
+		}
+		var dirs []string
+		for _, dirPath := range dirPaths {
+			var err error
+			if dirs, err = appendDir(dirs, dirPath); err != nil {
+				return err
+			}
+		}
+		w.dirPaths = dirs
+		return nil
+	}
+}
+
+// WithAddDir 追加一个监控的文件夹, 与已有文件夹重复或嵌套时返回错误
+func WithAddDir(dirPath string) Option {
+	return func(w *FileWatcher) error {
+		dirs, err := appendDir(w.dirPaths, dirPath)
+		if err != nil {
+			return err
+		}
+		w.dirPaths = dirs
+		return nil
+	}
+}
+
+// appendDir 追加文件夹, 并检查是否与已有文件夹重复或嵌套
+func appendDir(dirs []string, dirPath string) ([]string, error) {
+	if dirPath == "" {
+		return nil, errors.New("监控文件夹不能为空")
+	}
+	abs, err := filepath.Abs(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("获取文件夹(%s)绝对路径失败: %w", dirPath, err)
+	}
+	for _, dir := range dirs {
+		other, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("获取文件夹(%s)绝对路径失败: %w", dir, err)
+		}
+		if isSubDir(other, abs) || isSubDir(abs, other) {
+			return nil, fmt.Errorf("%w: %s, %s", ErrOverlappingDir, dir, dirPath)
+		}
+	}
+	return append(append([]string(nil), dirs...), dirPath), nil
+}
+
+// isSubDir 判断dir是否为parent本身或其子文件夹, 均需为绝对路径
+func isSubDir(parent, dir string) bool {
+	rel, err := filepath.Rel(parent, dir)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// WithFileRegexp 设置监控的文件名正则表达式, 为空时使用默认表达式; 默认匹配文件完整路径, 见WithMatchBaseName
+func WithFileRegexp(expr string) Option {
+	return func(w *FileWatcher) error {
+		if expr == "" {
+			expr = DefaultFileRegexp
+		}
+		re, err := compileFileRegexp(expr, w.caseInsensitive)
+		if err != nil {
+			return err
+		}
+		w.fileRegexp = expr
+		w.fileRe = re
+		return nil
+	}
+}
+
+// WithExcludeFileRegexp 设置排除的文件名正则表达式, 文件需匹配监控的表达式或glob模式且不匹配该表达式才会被监控,
+// 匹配方式与WithFileRegexp相同; 为空时不排除
+func WithExcludeFileRegexp(expr string) Option {
+	return func(w *FileWatcher) error {
+		if expr == "" {
+			w.excludeFileRegexp, w.excludeFileRe = "", nil
+			return nil
+		}
+		re, err := compileFileRegexp(expr, w.caseInsensitive)
+		if err != nil {
+			return err
+		}
+		w.excludeFileRegexp, w.excludeFileRe = expr, re
+		return nil
+	}
+}
+
+// WithExcludeFileRegexps 以一组排除的文件名正则表达式替换WithExcludeFileRegexp的设置, 文件匹配其中任意一个即不被监控,
+// 即文件需匹配监控的表达式且不匹配任何排除的表达式; 任意一个不合法时返回ErrInvalidRegexp且不做修改, 为空时不排除
+func WithExcludeFileRegexps(exprs ...string) Option {
+	return func(w *FileWatcher) error {
+		parts := make([]string, 0, len(exprs))
+		for _, expr := range exprs {
+			if expr == "" {
+				continue
+			}
+			// 逐个编译以便错误信息指出不合法的表达式
+			if _, err := compileFileRegexp(expr, w.caseInsensitive); err != nil {
+				return err
+			}
+			parts = append(parts, "(?:"+expr+")")
+		}
+		return WithExcludeFileRegexp(strings.Join(parts, "|"))(w)
+	}
+}
+
+// WithCaseInsensitiveMatch 设置文件名正则表达式与glob模式是否忽略大小写, 无需在表达式中自行添加(?i).
+// 开启后游标文件名也不区分大小写, 同一文件无论以哪种大小写形式被发现都使用同一个游标
+func WithCaseInsensitiveMatch(fold bool) Option {
+	return func(w *FileWatcher) error {
+		re, err := compileFileRegexp(w.fileRegexp, fold)
+		if err != nil {
+			return err
+		}
+		if w.excludeFileRegexp != "" {
+			if w.excludeFileRe, err = compileFileRegexp(w.excludeFileRegexp, fold); err != nil {
+				return err
+			}
+		}
+		if w.filePatterns, err = compileFilePatterns(w.filePatterns, fold); err != nil {
+			return err
+		}
+		w.caseInsensitive = fold
+		w.fileRe = re
+		return nil
+	}
+}
+
+// compileFileRegexp 编译文件名正则表达式, 为空时使用默认表达式, fold为true时忽略大小写
+func compileFileRegexp(expr string, fold bool) (*regexp.Regexp, error) {
+	if expr == "" {
+		expr = DefaultFileRegexp
+	}
+	src := expr
+	if fold {
+		src = "(?i)" + expr
+	}
+	re, err := regexp.Compile(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidRegexp, expr, err)
+	}
+	return re, nil
+}
+
+// WithMatchBaseName 设置文件名正则表达式是否只匹配文件名(filepath.Base), 默认匹配完整路径.
+// 开启后可使用^job-\d+\.log$这类锚定的表达式, 扫描与新建文件事件使用相同的匹配方式
+func WithMatchBaseName(base bool) Option {
+	return func(w *FileWatcher) error {
+		w.matchBaseName = base
+		return nil
+	}
+}
+
+// WithExcludeDirRegexp 设置排除的文件夹正则表达式, 匹配相对于监控文件夹的路径(以/分隔, 如tmp、.snapshots/2024),
+// 匹配的文件夹不添加到监控器, 扫描时也不进入; 为空时不排除
+func WithExcludeDirRegexp(expr string) Option {
+	return func(w *FileWatcher) error {
+		if expr == "" {
+			w.excludeDirRe = nil
+			return nil
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidRegexp, expr, err)
+		}
+		w.excludeDirRe = re
+		return nil
+	}
+}
+
+// WithIgnoreHidden 设置是否忽略以.开头的隐藏文件及文件夹(如.DS_Store、.nfs000000), 默认为true.
+// 只判断相对于监控文件夹的路径, 显式配置的隐藏文件夹本身仍会被监控
+func WithIgnoreHidden(ignore bool) Option {
+	return func(w *FileWatcher) error {
+		w.ignoreHidden = ignore
+		return nil
+	}
+}
+
+// WithCompleteMarker 设置文件的结束标记
+func WithCompleteMarker(marker string) Option {
+	return func(w *FileWatcher) error {
+		if marker == "" {
+			return errors.New("文件结束标记不能为空")
+		}
+		w.completeMarker = marker
+		return nil
+	}
+}
+
+// WithCompleteMarkerRegexp 设置文件结束标记的正则表达式(如DONE:job_\d+), 与WithCompleteMarker设置的字符串同时生效,
+// 行内容等于结束标记或匹配该表达式时均认为文件结束; 为nil时只使用字符串
+func WithCompleteMarkerRegexp(re *regexp.Regexp) Option {
+	return func(w *FileWatcher) error {
+		w.completeMarkerRe = re
+		return nil
+	}
+}
+
+// WithMaxNoUpdateTime 设置文件最大未更新时间, 用来结束监控协程
+func WithMaxNoUpdateTime(dur time.Duration) Option {
+	return func(w *FileWatcher) error {
+		if dur <= 0 {
+			return fmt.Errorf("%w, 当前: %v", ErrInvalidMaxNoUpdateTime, dur)
+		}
+		w.maxNoUpdateTime = dur
+		return nil
+	}
+}
+
+// WithRemoveAfterComplete 设置监控完毕后是否删除该文件
+func WithRemoveAfterComplete(remove bool) Option {
+	return func(w *FileWatcher) error {
+		w.removeAfterComplete = remove
+		return nil
+	}
+}
+
+// WithResChanBuffer 设置结果通道的缓冲大小, 0表示无缓冲. 结果通道在NewWatcher时按该大小创建一次,
+// 之后(SetResChanSize、Reconfigure)修改为不同的大小时返回ErrResChanSizeFixed, 避免已获取结果通道的消费者读取到不再使用的通道
+func WithResChanBuffer(size int) Option {
+	return func(w *FileWatcher) error {
+		if size < 0 {
+			return fmt.Errorf("结果通道缓冲大小不能小于0, 当前: %d", size)
+		}
+		// NewWatcher应用完所有配置后才创建结果通道
+		if w.ResChan != nil && size != w.resChanSize {
+			return fmt.Errorf("%w, 当前: %d", ErrResChanSizeFixed, w.resChanSize)
+		}
+		w.resChanSize = size
+		return nil
+	}
+}
+
+// Validate 校验watcher的配置, Start时会自动调用
+func (w *FileWatcher) Validate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fileGlob != "" && w.fileRegexp != "" {
+		return ErrGlobAndRegexp
+	}
+	if len(w.filePatterns) > 0 && (w.fileGlob != "" || w.fileRegexp != "") {
+		return ErrPatternConflict
+	}
+	re, err := compileFileRegexp(w.fileRegexp, w.caseInsensitive)
+	if err != nil {
+		return err
+	}
+	w.fileRe = re
+	if w.excludeFileRegexp != "" {
+		if w.excludeFileRe, err = compileFileRegexp(w.excludeFileRegexp, w.caseInsensitive); err != nil {
+			return err
+		}
+	}
+
+	for _, dirPath := range w.watchDirs() {
+		if err := checkDir(dirPath); err != nil {
+			return err
+		}
+	}
+
+	if w.maxNoUpdateTime <= 0 {
+		return fmt.Errorf("%w, 当前: %v", ErrInvalidMaxNoUpdateTime, w.maxNoUpdateTime)
+	}
+	return nil
+}
+
+// WithChanBuffer 同WithResChanBuffer
+func WithChanBuffer(size int) Option {
+	return WithResChanBuffer(size)
+}
+
+// WithRescanInterval 设置定期重新扫描文件夹的间隔, 用于补充遗漏的文件创建事件, 0表示不重新扫描
+func WithRescanInterval(dur time.Duration) Option {
+	return func(w *FileWatcher) error {
+		if dur < 0 {
+			return fmt.Errorf("重新扫描间隔不能小于0, 当前: %v", dur)
+		}
+		w.rescanInterval = dur
+		return nil
+	}
+}
+
+// WithPollingInterval 设置以轮询代替fsnotify监听单个文件的变化, 文件变大时读取新内容, 0表示不轮询.
+// 适用于NFS、CIFS等fsnotify事件不可靠的文件系统, 文件夹仍通过fsnotify监控
+func WithPollingInterval(dur time.Duration) Option {
+	return func(w *FileWatcher) error {
+		if dur < 0 {
+			return fmt.Errorf("轮询间隔不能小于0, 当前: %v", dur)
+		}
+		w.pollingInterval = dur
+		return nil
+	}
+}
+
+// WithMaxConcurrentFiles 设置同时监听的最大文件数, 超出的文件按修改时间从早到晚排队等待, 0表示不限制
+func WithMaxConcurrentFiles(n int) Option {
+	return func(w *FileWatcher) error {
+		if n < 0 {
+			return fmt.Errorf("最大并发文件数不能小于0, 当前: %d", n)
+		}
+		w.maxConcurrentFiles = n
+		return nil
+	}
+}
+
+// WithCreateDir 设置监控文件夹不存在时以perm权限自动创建, 0表示不创建
+func WithCreateDir(perm os.FileMode) Option {
+	return func(w *FileWatcher) error {
+		w.createDirPerm = perm
+		return nil
+	}
+}
+
+// WithWaitForDir 设置启动时等待监控文件夹出现的最长时间, 0表示不等待.
+// 等待期间按1s、2s、4s...的间隔(最长30s)检查文件夹是否出现, 超时后Start返回ErrDirNotExist
+func WithWaitForDir(timeout time.Duration) Option {
+	return func(w *FileWatcher) error {
+		if timeout < 0 {
+			return fmt.Errorf("等待文件夹的时间不能小于0, 当前: %v", timeout)
+		}
+		w.waitForDir = timeout
+		return nil
+	}
+}
+
+// WithStartupWait 同WithWaitForDir, 文件夹不存在时以指数退避等待其出现, 最长等待maxWait后正常启动或返回错误
+func WithStartupWait(maxWait time.Duration) Option {
+	return WithWaitForDir(maxWait)
+}
+
+// WithStopTimeout 设置Stop等待监控协程退出的超时时间, 0表示一直等待
+func WithStopTimeout(dur time.Duration) Option {
+	return func(w *FileWatcher) error {
+		if dur < 0 {
+			return fmt.Errorf("停止超时时间不能小于0, 当前: %v", dur)
+		}
+		w.stopTimeout = dur
+		return nil
+	}
+}
+
+// WithMaxBatchBytes 设置单批次内容的最大字节数, 超过后立即发送, 0表示不限制
+func WithMaxBatchBytes(size int64) Option {
+	return func(w *FileWatcher) error {
+		if size < 0 {
+			return fmt.Errorf("单批次最大字节数不能小于0, 当前: %d", size)
+		}
+		w.maxBatchBytes = size
+		return nil
+	}
+}
+
+// WithFlushInterval 设置未凑满一批时发送已读取内容的最长间隔, 实时告警等场景可设置为亚秒级.
+// 0表示使用默认值DefaultFlushInterval
+func WithFlushInterval(d time.Duration) Option {
+	return func(w *FileWatcher) error {
+		if d < 0 {
+			return fmt.Errorf("发送间隔不能小于0, 当前: %v", d)
+		}
+		if d == 0 {
+			d = DefaultFlushInterval
+		}
+		w.flushInterval = d
+		return nil
+	}
+}
+
+// WithSubscribePolicy 设置订阅者(见Subscribe)通道已满时的处理方式, 默认为SubscribeDrop
+func WithSubscribePolicy(policy SubscribePolicy) Option {
+	return func(w *FileWatcher) error {
+		if policy != SubscribeDrop && policy != SubscribeBlock {
+			return fmt.Errorf("未知的订阅策略: %d", policy)
+		}
+		w.subscribePolicy = policy
+		return nil
+	}
+}
+
+// WithCompressContent 设置是否以gzip压缩发送的内容, 适用于内容较大、需转发至远端的场景.
+// 压缩后FileContent.Compressed为true, 可通过FileContent.Decompress获取原始内容
+func WithCompressContent(compress bool) Option {
+	return func(w *FileWatcher) error {
+		w.compressContent = compress
+		return nil
+	}
+}
+
+// WithMaxFileSize 设置可监听的最大文件大小(字节), 开始监听时超过的文件不读取, 并以ErrFileTooLarge通过错误处理函数告警;
+// 监听期间超过时发送剩余内容及StatusTooLarge后不再读取. 0表示不限制
+func WithMaxFileSize(size int64) Option {
+	return func(w *FileWatcher) error {
+		if size < 0 {
+			return fmt.Errorf("最大文件大小不能小于0, 当前: %d", size)
+		}
+		w.maxFileSize = size
+		return nil
+	}
+}
+
+// WithMaxLineBytes 设置单行内容的最大长度(字节), 超过时该文件停止读取并上报bufio.ErrTooLong, 0表示使用默认值DefaultMaxLineBytes
+func WithMaxLineBytes(n int) Option {
+	return func(w *FileWatcher) error {
+		if n < 0 {
+			return fmt.Errorf("单行最大长度不能小于0, 当前: %d", n)
+		}
+		if n == 0 {
+			n = DefaultMaxLineBytes
+		}
+		w.maxLineBytes = n
+		return nil
+	}
+}
+
+// WithTruncateToEnd 设置开始读取时发现文件被截断(游标超过文件大小)的处理方式: true时从截断后的末尾开始读取,
+// 只读取之后新增的内容; 默认为false, 从头读取. 两种情况下都会发送一次Truncated为true的内容并重写游标
+func WithTruncateToEnd(toEnd bool) Option {
+	return func(w *FileWatcher) error {
+		w.truncateToEnd = toEnd
+		return nil
+	}
+}
+
+// WithTailOversize 设置开始监听时超过大小限制的文件是否跳至末尾, 只读取之后新增的内容(跳过的内容不会发送, 会输出警告),
+// 此类文件监听期间不再检查大小限制; 默认为false, 即跳过整个文件. 压缩文件无法跳至末尾, 仍跳过整个文件
+func WithTailOversize(tail bool) Option {
+	return func(w *FileWatcher) error {
+		w.tailOversize = tail
+		return nil
+	}
+}
+
+// WithSkipBinary 设置是否跳过内容为二进制的文件(如误命名为.log的core dump), 开始监听时检查文件开头的内容,
+// 含有NUL字节或大量不合法的UTF-8字节时不读取, 并以ErrBinaryFile通过错误处理函数告警. 默认为false
+func WithSkipBinary(skip bool) Option {
+	return func(w *FileWatcher) error {
+		w.skipBinary = skip
+		return nil
+	}
+}
+
+// WithDeferEmptyFiles 设置扫描时发现的空文件是否待写入后再开始监听. 开启后运行中扫描到的空文件只记录下来,
+// 收到其写入事件后再开始监听, 避免大量预先创建的空文件各占用一个协程与文件描述符. 默认为false
+func WithDeferEmptyFiles(deferEmpty bool) Option {
+	return func(w *FileWatcher) error {
+		w.deferEmpty = deferEmpty
+		return nil
+	}
+}
+
+// WithCursorStore 设置游标的存储方式, 如保存至数据库; 为nil时使用默认的游标文件(见WithCursorDir).
+// 读写游标的错误通过错误处理函数上报
+func WithCursorStore(store CursorStore) Option {
+	return func(w *FileWatcher) error {
+		w.cursorStore = store
+		return nil
+	}
+}
+
+// WithInMemoryCursors 游标只保存在内存中, 不创建任何游标文件, 适用于测试或无需断点续读的场景.
+// 进程内重新监听同一文件时仍从游标处继续读取, 但进程重启后游标丢失, 文件将从头读取.
+// 会覆盖WithCursorStore设置的存储
+func WithInMemoryCursors() Option {
+	return func(w *FileWatcher) error {
+		w.cursorStore = newMemoryCursorStore()
+		return nil
+	}
+}
+
+// WithCursorSaveInterval 设置游标的最小保存间隔: 内存中的游标随发送推进, 游标文件在间隔内最多写入一次,
+// 用于减少大量活跃文件时的磁盘写入; 读取完毕、停止监听时总会立即保存. 0表示每次发送后都保存.
+// 间隔内机器崩溃或进程被强制结束时, 重启后会重复发送上次保存之后的内容
+func WithCursorSaveInterval(d time.Duration) Option {
+	return func(w *FileWatcher) error {
+		if d < 0 {
+			return fmt.Errorf("游标保存间隔不能小于0, 当前: %v", d)
+		}
+		w.cursorSaveInterval = d
+		return nil
+	}
+}
+
+// WithCursorGranularity 设置游标的保存粒度, 默认为CursorPerBatch. 无论哪种粒度, 保存的游标都恰好位于已发送内容的末尾;
+// CursorPerDelivery时每发送一次内容都立即保存, 以更多的写入换取更小的重复发送范围
+func WithCursorGranularity(g CursorGranularity) Option {
+	return func(w *FileWatcher) error {
+		if g != CursorPerBatch && g != CursorPerDelivery {
+			return fmt.Errorf("未知的游标保存粒度: %d", g)
+		}
+		w.cursorGranularity = g
+		return nil
+	}
+}
+
+// WithAckMode 设置是否开启确认模式: 发送的内容需由调用方调用FileContent.Ack确认,
+// 游标只推进到按发送顺序连续确认的内容, 读取完毕时全部内容确认后才删除文件(见WithRemoveAfterComplete).
+// 调用Nack或超过WithAckTimeout设置的时长未确认的内容会被重新发送; 停止时未确认的内容在下次监听时重新读取.
+// 未确认的内容会一直保留在内存中, 仅对Watch(及Start启动的监听)生效, DrainOnce发送后即保存游标
+func WithAckMode(enable bool) Option {
+	return func(w *FileWatcher) error {
+		w.ackMode = enable
+		return nil
+	}
+}
+
+// WithAckTimeout 设置确认模式下内容的确认超时, 超时未确认的内容会被重新发送, 0表示只在Nack时重新发送
+func WithAckTimeout(d time.Duration) Option {
+	return func(w *FileWatcher) error {
+		if d < 0 {
+			return fmt.Errorf("确认超时不能小于0, 当前: %v", d)
+		}
+		w.ackTimeout = d
+		return nil
+	}
+}
+
+// WithCursorSync 设置保存游标文件时是否调用fsync落盘, 默认开启, 首次创建游标文件时还会对所在目录落盘,
+// 机器崩溃时不会丢失已保存的游标. 关闭后每次保存游标的开销明显减小, 但崩溃后游标文件可能为空或回退到较早的游标,
+// 为空时按损坏处理(见WithRefuseBadCursor), 文件会被从头重新发送. 仅对默认的游标文件生效.
+// 可配合WithCursorSaveInterval减少落盘次数, 在可靠性与吞吐量之间取舍
+func WithCursorSync(sync bool) Option {
+	return func(w *FileWatcher) error {
+		w.cursorSync = sync
+		return nil
+	}
+}
+
+// WithCursorDir 设置游标文件的存放目录, 游标文件以被监听文件绝对路径的SHA-256命名, 为空时存放在被监听文件旁.
+// 目录中还没有某文件的游标而文件旁有旧的游标文件时, 开始监听该文件时会导入旧的游标
+func WithCursorDir(dirPath string) Option {
+	return func(w *FileWatcher) error {
+		w.cursorDir = dirPath
+		return nil
+	}
+}
+
+// WithRotationSupport 设置是否支持文件轮转(重命名后创建同名新文件), 开启时等待新文件的时长为DefaultRotationGrace
+func WithRotationSupport(enable bool) Option {
+	if !enable {
+		return WithRotationGrace(0)
+	}
+	return WithRotationGrace(DefaultRotationGrace)
+}
+
+// WithRotationGrace 设置文件被删除或重命名后等待同名新文件出现的时长, 0表示不支持轮转.
+// 新文件出现后游标重置为0并从头读取, 两段内容之间会发送一次Rotated为true的内容
+func WithRotationGrace(grace time.Duration) Option {
+	return func(w *FileWatcher) error {
+		if grace < 0 {
+			return fmt.Errorf("轮转等待时长不能小于0, 当前: %v", grace)
+		}
+		w.rotationGrace = grace
+		return nil
+	}
+}
+
+// WithMinFileAge 设置运行中新建的文件开始监听前需满足的最小年龄(距最后修改的时长), 期间文件被写入时重新计时,
+// 用于避免读取rsync等工具尚未复制完成的文件; 启动及定期扫描时发现的已有文件不受影响. 0表示立即开始
+func WithMinFileAge(d time.Duration) Option {
+	return func(w *FileWatcher) error {
+		if d < 0 {
+			return fmt.Errorf("最小文件年龄不能小于0, 当前: %v", d)
+		}
+		w.minFileAge = d
+		return nil
+	}
+}
+
+// WithTailExisting 设置启动时已有的文件是否只读取新增的内容(类似tail -f), 没有游标的文件以当前末尾作为初始游标,
+// 已有游标的文件仍从游标处继续读取; 运行中新建的文件不受影响, 从头读取
+func WithTailExisting(tail bool) Option {
+	return func(w *FileWatcher) error {
+		w.tailExisting = tail
+		return nil
+	}
+}
+
+// WithRefuseBadCursor 设置游标文件损坏(如写入时崩溃导致为空或不完整)时是否拒绝监控该文件,
+// 默认从头读取, 并将ErrBadCursor交由错误处理函数上报
+func WithRefuseBadCursor(refuse bool) Option {
+	return func(w *FileWatcher) error {
+		w.refuseBadCursor = refuse
+		return nil
+	}
+}
+
+// WithDecompress 设置是否自动解压.gz、.zst文件后再读取. 压缩文件视为一个整体, 游标记录解压后已发送的行数,
+// 恢复时从头解压并跳过这些行; 压缩文件应一次写完, 不支持追加写入
+func WithDecompress(decompress bool) Option {
+	return func(w *FileWatcher) error {
+		w.decompress = decompress
+		return nil
+	}
+}
+
+// WithRecursive 设置是否监控子文件夹, 默认为true; 为false时只监控文件夹下直接存放的文件
+func WithRecursive(recursive bool) Option {
+	return func(w *FileWatcher) error {
+		w.recursive = recursive
+		return nil
+	}
+}
+
+// WithMaxDepth 设置监控的子文件夹最大深度, 1表示只监控直接子文件夹, 0表示不限制
+func WithMaxDepth(n int) Option {
+	return func(w *FileWatcher) error {
+		if n < 0 {
+			return fmt.Errorf("最大深度不能小于0, 当前: %d", n)
+		}
+		w.maxDepth = n
+		return nil
+	}
+}
+
+// WithFollowSymlinks 设置是否监听指向普通文件的符号链接, 读取链接指向的文件, 结果中的路径仍为链接路径
+func WithFollowSymlinks(follow bool) Option {
+	return func(w *FileWatcher) error {
+		w.followSymlinks = follow
+		return nil
+	}
+}
+
+// WithRecordDelimiter 设置多行记录(如异常堆栈)的分隔函数, 函数返回true的行为一条记录的最后一行.
+// 设置后每条完整的记录作为一个内容单独发送; 停止或文件结束时未完成的记录也会发送
+func WithRecordDelimiter(delimiter func(line []byte) bool) Option {
+	return func(w *FileWatcher) error {
+		w.recordDelimiter = delimiter
+		return nil
+	}
+}
+
+// WithLineFilter 设置行过滤函数, 返回false的行不发送, 结束标记行不受影响
+func WithLineFilter(filter func(line []byte) bool) Option {
+	return func(w *FileWatcher) error {
+		w.lineFilter = filter
+		return nil
+	}
+}
+
+// WithLineTransformer 设置行转换函数, 在过滤之后、写入批次之前调用, 结束标记行不受影响
+func WithLineTransformer(transformer func(line []byte) []byte) Option {
+	return func(w *FileWatcher) error {
+		w.lineTransformer = transformer
+		return nil
+	}
+}
+
+// WithErrorHandler 设置错误处理函数, 为nil时以Error级别输出日志
+func WithErrorHandler(handler func(error)) Option {
+	return func(w *FileWatcher) error {
+		w.errorHandler = handler
+		return nil
+	}
+}
+
+// WithOnFileStart 设置文件开始监听(已打开文件并定位到游标处)时的回调函数, 在该文件的监听协程中同步调用,
+// 可用于维护正在监听的文件列表、启动计时等
+func WithOnFileStart(hook func(filePath string)) Option {
+	return func(w *FileWatcher) error {
+		w.onFileStart = hook
+		return nil
+	}
+}
+
+// WithOnFileComplete 设置文件读取完毕(遇到结束标志符或长时间未更新)时的回调函数,
+// 在该文件的监听协程中同步调用, 此时剩余内容已发送至结果通道; 可用于归档文件、通知下游等.
+// 开始监听后因错误退出时同样会调用, err为导致退出的错误, 正常读取完毕时为nil
+func WithOnFileComplete(hook func(filePath string, err error)) Option {
+	return func(w *FileWatcher) error {
+		w.onFileComplete = hook
+		return nil
+	}
+}
+
+// WithLogHandler 设置提示信息处理函数, 结构化的字段格式化为"msg key=value ..."后传入; 为nil时通过logger输出
+func WithLogHandler(handler func(string)) Option {
+	return func(w *FileWatcher) error {
+		w.logHandler = handler
+		return nil
+	}
+}
+
+// WithLogger 设置输出日志使用的logger, 未设置LogHandler、ErrorHandler时日志与错误均通过其输出; 为nil时使用slog.Default()
+func WithLogger(logger *slog.Logger) Option {
+	return func(w *FileWatcher) error {
+		w.logger = logger
+		return nil
+	}
+}
+
+// checkDir 检查文件夹是否存在
+func checkDir(dirPath string) error {
+	info, err := os.Stat(dirPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrDirNotExist, dirPath)
+	}
+	if err != nil {
+		return fmt.Errorf("查询文件夹(%s)信息时失败: %w", dirPath, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s", ErrNotDir, dirPath)
+	}
+	return nil
+}
+
+// WithStatsObserver 设置统计事件的接收者
+func WithStatsObserver(observer StatsObserver) Option {
+	return func(w *FileWatcher) error {
+		w.statsObserver = observer
+		return nil
+	}
+}
+
+// configure 供Set系列方法使用, 监控任务运行中或有Watch、DrainOnce正在读取时拒绝修改并返回ErrWatching,
+// 配置不合法时返回错误并保留原配置
+func (w *FileWatcher) configure(opt Option) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.busy() {
+		return ErrWatching
+	}
+	return opt(w)
+}
+
+// busy 配置是否正在被使用, 需持有mu
+func (w *FileWatcher) busy() bool {
+	return w.Watching() || w.readers > 0
+}
+
+// enterRead 标记开始读取配置, 与leaveRead成对调用
+func (w *FileWatcher) enterRead() {
+	w.mu.Lock()
+	w.readers++
+	w.mu.Unlock()
+}
+
+// leaveRead 标记读取配置结束
+func (w *FileWatcher) leaveRead() {
+	w.mu.Lock()
+	w.readers--
+	w.mu.Unlock()
+}
@@ -0,0 +1,115 @@
+package filewatch
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewWatcherDefaults(t *testing.T) {
+	w, err := NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dirs := w.watchDirs(); len(dirs) != 1 || dirs[0] != DefaultDirPath {
+		t.Errorf("dirs = %v, want [%s]", dirs, DefaultDirPath)
+	}
+	if w.fileRe.String() != DefaultFileRegexp {
+		t.Errorf("fileRe = %s, want %s", w.fileRe, DefaultFileRegexp)
+	}
+	if w.completeMarker != DefaultCompleteMarker {
+		t.Errorf("completeMarker = %q, want %q", w.completeMarker, DefaultCompleteMarker)
+	}
+	if w.maxNoUpdateTime != DefaultMaxNoUpdateTime {
+		t.Errorf("maxNoUpdateTime = %v, want %v", w.maxNoUpdateTime, DefaultMaxNoUpdateTime)
+	}
+	if w.removeAfterComplete {
+		t.Error("removeAfterComplete默认应为false")
+	}
+	if cap(w.ResChan) != 0 {
+		t.Errorf("ResChan缓冲 = %d, want 0", cap(w.ResChan))
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"regexp":          WithFileRegexp(`(`),
+		"glob":            WithFileGlob(`[`),
+		"zero timeout":    WithMaxNoUpdateTime(0),
+		"negative buffer": WithResChanBuffer(-1),
+		"empty marker":    WithCompleteMarker(""),
+	} {
+		if _, err := NewWatcher(opt); err == nil {
+			t.Errorf("%s: NewWatcher应返回错误", name)
+		}
+	}
+	if _, err := NewWatcher(WithMaxNoUpdateTime(-time.Second)); !errors.Is(err, ErrInvalidMaxNoUpdateTime) {
+		t.Errorf("err = %v, want ErrInvalidMaxNoUpdateTime", err)
+	}
+}
+
+func TestOptionConflicts(t *testing.T) {
+	dir := t.TempDir()
+	for name, c := range map[string]struct {
+		opts []Option
+		want error
+	}{
+		"glob and regexp":    {[]Option{WithFileGlob("*.log"), WithFileRegexp(`\.log$`)}, ErrGlobAndRegexp},
+		"pattern and glob":   {[]Option{WithFilePattern(`^a`), WithFileGlob("*.log")}, ErrPatternConflict},
+		"pattern and regexp": {[]Option{WithFilePattern(`^a`), WithFileRegexp(`\.log$`)}, ErrPatternConflict},
+		"missing dir":        {[]Option{WithDir(filepath.Join(dir, "missing"))}, ErrDirNotExist},
+		"no conflict":        {[]Option{WithFilePattern(`^a`), WithFilePattern(`^b`)}, nil},
+	} {
+		w, err := NewWatcher(append([]Option{WithDir(dir)}, c.opts...)...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := w.Validate(); !errors.Is(err, c.want) {
+			t.Errorf("%s: Validate() = %v, want %v", name, err, c.want)
+		}
+	}
+}
+
+func TestSettersValidate(t *testing.T) {
+	w, err := NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 与Option共用校验, 不合法的值不生效
+	if err := w.SetFileRegexp(`(`); err == nil {
+		t.Error("SetFileRegexp应返回错误")
+	}
+	if w.fileRe.String() != DefaultFileRegexp {
+		t.Errorf("fileRe被修改为 %s", w.fileRe)
+	}
+	if err := w.SetMaxNoUpdateTime(0); !errors.Is(err, ErrInvalidMaxNoUpdateTime) {
+		t.Errorf("SetMaxNoUpdateTime() = %v, want ErrInvalidMaxNoUpdateTime", err)
+	}
+	if w.maxNoUpdateTime != DefaultMaxNoUpdateTime {
+		t.Errorf("maxNoUpdateTime被修改为 %v", w.maxNoUpdateTime)
+	}
+}
+
+func TestResChanSizeFixed(t *testing.T) {
+	w, err := NewWatcher(WithResChanBuffer(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := w.GetResChan()
+	if cap(ch) != 4 {
+		t.Fatalf("ResChan缓冲 = %d, want 4", cap(ch))
+	}
+	if err := w.Reconfigure(WithResChanBuffer(8)); !errors.Is(err, ErrResChanSizeFixed) {
+		t.Errorf("Reconfigure() = %v, want ErrResChanSizeFixed", err)
+	}
+	if err := w.Reconfigure(WithResChanBuffer(4)); err != nil {
+		t.Errorf("大小不变时Reconfigure() = %v", err)
+	}
+	if err := w.SetResChanSize(8); !errors.Is(err, ErrResChanSizeFixed) {
+		t.Errorf("SetResChanSize() = %v, want ErrResChanSizeFixed", err)
+	}
+	if got := w.GetResChan(); got != ch {
+		t.Error("已获取的结果通道被替换")
+	}
+}
@@ -0,0 +1,88 @@
+package filewatch
+
+import (
+	"regexp"
+	"slices"
+)
+
+// filePattern 通过AddFilePattern或AddProfile添加的文件名正则表达式
+type filePattern struct {
+	expr    string
+	re      *regexp.Regexp
+	profile *Profile // 通过AddProfile添加时不为空
+}
+
+// WithFilePattern 添加一个监控的文件名正则表达式, 可多次添加, 文件按添加顺序依次匹配, 匹配任意一个即被监控,
+// 首个匹配的表达式记录在FileContent.Pattern中, 便于按来源分类处理. 匹配方式与WithFileRegexp相同,
+// 不能与WithFileRegexp、WithFileGlob同时设置, 否则Validate时返回ErrPatternConflict
+func WithFilePattern(expr string) Option {
+	return func(w *FileWatcher) error {
+		re, err := compileFileRegexp(expr, w.caseInsensitive)
+		if err != nil {
+			return err
+		}
+		// 不在原切片上追加, 避免与Reconfigure的副本共用底层数组
+		w.filePatterns = append(slices.Clip(w.filePatterns), filePattern{expr: expr, re: re})
+		return nil
+	}
+}
+
+// AddFilePattern 添加一个监控的文件名正则表达式, 文件匹配任意一个已添加的表达式即被监控
+func (w *FileWatcher) AddFilePattern(expr string) error {
+	return w.configure(WithFilePattern(expr))
+}
+
+// WithFileRegexps 以一组文件名正则表达式替换通过WithFilePattern添加的全部表达式, 文件匹配任意一个即被监控.
+// 全部表达式编译通过后才会替换, 任意一个不合法时返回ErrInvalidRegexp且不做修改; 通过WithProfile添加的表达式保持不变,
+// 新的表达式排在其后匹配.
+// 与WithFilePattern相同, 不能与WithFileRegexp、WithFileGlob同时设置
+func WithFileRegexps(exprs ...string) Option {
+	return func(w *FileWatcher) error {
+		patterns := make([]filePattern, 0, len(w.filePatterns)+len(exprs))
+		for _, p := range w.filePatterns {
+			if p.profile != nil {
+				patterns = append(patterns, p)
+			}
+		}
+		for _, expr := range exprs {
+			re, err := compileFileRegexp(expr, w.caseInsensitive)
+			if err != nil {
+				return err
+			}
+			patterns = append(patterns, filePattern{expr: expr, re: re})
+		}
+		w.filePatterns = patterns
+		return nil
+	}
+}
+
+// SetFileRegexps 以一组文件名正则表达式替换已添加的表达式, 文件匹配任意一个即被监控, 表达式不合法时返回错误
+func (w *FileWatcher) SetFileRegexps(exprs []string) error {
+	return w.configure(WithFileRegexps(exprs...))
+}
+
+// compileFilePatterns 按是否忽略大小写重新编译已添加的表达式, 返回新的切片
+func compileFilePatterns(patterns []filePattern, fold bool) ([]filePattern, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	compiled := make([]filePattern, len(patterns))
+	for i, p := range patterns {
+		re, err := compileFileRegexp(p.expr, fold)
+		if err != nil {
+			return nil, err
+		}
+		compiled[i] = filePattern{expr: p.expr, re: re, profile: p.profile}
+	}
+	return compiled, nil
+}
+
+// matchPattern 返回首个匹配name的表达式
+func matchPattern(patterns []filePattern, name string) (*filePattern, bool) {
+	for i := range patterns {
+		if patterns[i].re.MatchString(name) {
+			return &patterns[i], true
+		}
+	}
+	return nil, false
+}
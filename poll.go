@@ -0,0 +1,85 @@
+package filewatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// pollFileEvent 以轮询代替fsnotify监听文件变化, 文件变大时触发扫描.
+// 适用于NFS、CIFS、Docker挂载目录等fsnotify事件不可靠的场景
+// origin为开始监听时的文件, 文件路径指向其他文件时通知statusReplaced; 出错时与watchFileEvent相同, 错误写入errChan
+func (w *FileWatcher) pollFileEvent(ctx context.Context, filePath string, origin os.FileInfo, maxNoUpdateTime time.Duration, scanChan chan ContentStatus, errChan chan<- error) {
+	defer w.info("文件轮询结束", slog.String("file", filePath))
+	// Watch退出后不再读取scanChan, 发送时需同时关注ctx, 避免阻塞
+	notify := func(status ContentStatus) {
+		select {
+		case scanChan <- status:
+		case <-ctx.Done():
+		}
+	}
+	realPath := w.resolvePath(filePath)
+	var lastSize int64
+	lastInfo := origin
+	if lastInfo != nil {
+		lastSize = lastInfo.Size()
+	}
+
+	// 为了立即读一次, 直接触发一次扫描
+	notify(StatusContinue)
+
+	ticker := time.NewTicker(w.pollingInterval)
+	defer ticker.Stop()
+	timer := time.NewTicker(maxNoUpdateTime)
+	defer timer.Stop()
+
+	for {
+		_, resume := w.pauseState()
+		select {
+		case <-ctx.Done():
+			return
+		case <-resume:
+			// 暂停期间不计算未更新时长, 恢复后重新计时
+			timer.Reset(maxNoUpdateTime)
+		case <-ticker.C:
+			info, err := os.Stat(realPath)
+			if errors.Is(err, fs.ErrNotExist) {
+				w.info("文件读取完毕", slog.String("file", filePath))
+				notify(StatusRemoved)
+				return
+			}
+			if err != nil {
+				select {
+				case errChan <- fmt.Errorf("查询文件(%s)信息时失败: %w", filePath, err):
+				default:
+				}
+				notify(StatusError)
+				return
+			}
+			// 同名文件已被替换, 旧文件不会再有内容
+			if lastInfo != nil && !os.SameFile(lastInfo, info) {
+				w.info("文件已被替换", slog.String("file", filePath))
+				notify(statusReplaced)
+				return
+			}
+			if info.Size() > lastSize {
+				if len(scanChan) <= 1 {
+					scanChan <- StatusContinue
+				}
+				timer.Reset(maxNoUpdateTime)
+			}
+			lastSize = info.Size()
+		case <-timer.C:
+			if paused, _ := w.pauseState(); paused {
+				continue
+			}
+			w.info("文件长时间未更新, 认为文件读取完毕, 不再监控", slog.String("file", filePath), slog.Duration("timeout", maxNoUpdateTime))
+			notify(StatusTimeout)
+			return
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package filewatch
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+)
+
+// pendingFile 等待空闲名额的文件
+type pendingFile struct {
+	ctx      context.Context
+	filePath string
+	modTime  time.Time // 入队时文件的修改时间, 队列按其从早到晚排列
+}
+
+// goWatch 在新协程中监听文件, 并纳入Stop的等待范围.
+// 设置了最大并发文件数时, 超出的文件进入队列, 待已有文件监听结束后再依次开始
+func (w *FileWatcher) goWatch(ctx context.Context, filePath string) {
+	// 已在监听或排队中的文件直接跳过, 避免重复扫描时产生无用的协程
+	if w.isWatched(filePath) {
+		return
+	}
+	if w.maxConcurrentFiles <= 0 {
+		w.spawnWatch(ctx, filePath)
+		return
+	}
+
+	w.poolMu.Lock()
+	defer w.poolMu.Unlock()
+	key := fileKey(filePath)
+	for _, p := range w.pending {
+		if fileKey(p.filePath) == key {
+			return
+		}
+	}
+	if w.running < w.maxConcurrentFiles {
+		w.running++
+		w.spawnWatch(ctx, filePath)
+		return
+	}
+	// 按修改时间排队, 最早修改的文件优先开始监听; 修改时间相同时排在已有文件之后, 查询失败时排在最后
+	p := pendingFile{ctx: ctx, filePath: filePath}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		w.pending = append(w.pending, p)
+		return
+	}
+	p.modTime = info.ModTime()
+	i, _ := slices.BinarySearchFunc(w.pending, p, func(a, b pendingFile) int {
+		if a.modTime.IsZero() || a.modTime.After(b.modTime) {
+			return 1
+		}
+		return -1
+	})
+	w.pending = slices.Insert(w.pending, i, p)
+}
+
+// watchScanned 监听一次扫描发现的全部文件, 先排序再开始监听, 见sortScanned
+func (w *FileWatcher) watchScanned(ctx context.Context, paths []string) {
+	w.sortScanned(paths)
+	for _, path := range paths {
+		w.info("Watching", slog.String("file", path))
+		w.scanWatch(ctx, path)
+	}
+}
+
+// sortScanned 设置了最大并发文件数时, 将扫描发现的文件按修改时间从早到晚排序, 使最早修改的文件先占用名额,
+// 而不是按遍历顺序; 修改时间相同时保持遍历顺序, 查询失败的排在最后
+func (w *FileWatcher) sortScanned(paths []string) {
+	if w.maxConcurrentFiles <= 0 || len(paths) < 2 {
+		return
+	}
+	modTimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	slices.SortStableFunc(paths, func(a, b string) int {
+		ta, tb := modTimes[a], modTimes[b]
+		switch {
+		case ta.IsZero() && !tb.IsZero():
+			return 1
+		case tb.IsZero() && !ta.IsZero():
+			return -1
+		}
+		return ta.Compare(tb)
+	})
+}
+
+// scanWatch 监听扫描时发现的文件. 设置了延迟监听空文件时, 运行中发现的空文件只记录下来,
+// 待监控任务收到其写入事件后再开始监听, 避免大量预先创建的空文件占用文件描述符
+func (w *FileWatcher) scanWatch(ctx context.Context, filePath string) {
+	if w.deferEmpty && w.Watching() && !w.isWatched(filePath) {
+		if info, err := os.Stat(filePath); err == nil && info.Size() == 0 {
+			w.emptyFiles.Store(fileKey(filePath), filePath)
+			return
+		}
+		// 写入事件可能早于文件夹添加到监控器, 再次扫描时已有内容则直接开始监听
+		w.emptyFiles.Delete(fileKey(filePath))
+	}
+	w.goWatch(ctx, filePath)
+}
+
+// promoteEmpty 延迟监听的空文件被写入后开始监听
+func (w *FileWatcher) promoteEmpty(ctx context.Context, filePath string) {
+	if _, ok := w.emptyFiles.LoadAndDelete(fileKey(filePath)); ok {
+		w.goWatch(ctx, filePath)
+	}
+}
+
+// watchNew 监听运行中新创建的文件. 设置了最小文件年龄时, 等待文件的修改时间足够久后再开始监听,
+// 避免读取到仍在复制中的文件
+func (w *FileWatcher) watchNew(ctx context.Context, filePath string) {
+	if w.minFileAge <= 0 {
+		w.goWatch(ctx, filePath)
+		return
+	}
+	if w.isWatched(filePath) {
+		return
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		if w.waitFileAge(ctx, filePath) {
+			w.goWatch(ctx, filePath)
+		}
+	}()
+}
+
+// waitFileAge 等待文件的修改时间早于最小文件年龄, 期间文件被写入时重新计时; 文件不存在或被停止时返回false
+func (w *FileWatcher) waitFileAge(ctx context.Context, filePath string) bool {
+	for {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return false
+		}
+		wait := w.minFileAge - time.Since(info.ModTime())
+		if wait <= 0 {
+			return true
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// spawnWatch 启动监听协程, 受并发限制时结束后会从队列中取出下一个文件
+func (w *FileWatcher) spawnWatch(ctx context.Context, filePath string) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.Watch(ctx, filePath)
+		if w.maxConcurrentFiles > 0 {
+			w.next()
+		}
+	}()
+}
+
+// next 当前文件监听结束后, 取出队列中下一个仍有效的文件开始监听, 队列为空时释放名额
+func (w *FileWatcher) next() {
+	w.poolMu.Lock()
+	defer w.poolMu.Unlock()
+	for len(w.pending) > 0 {
+		p := w.pending[0]
+		w.pending = w.pending[1:]
+		if p.ctx.Err() != nil {
+			continue
+		}
+		w.spawnWatch(p.ctx, p.filePath)
+		return
+	}
+	w.running--
+}
+
+// pendingFiles 获取排队中的文件
+func (w *FileWatcher) pendingFiles() []string {
+	w.poolMu.Lock()
+	defer w.poolMu.Unlock()
+	res := make([]string, 0, len(w.pending))
+	for _, p := range w.pending {
+		res = append(res, p.filePath)
+	}
+	return res
+}
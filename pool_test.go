@@ -0,0 +1,41 @@
+package filewatch
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrentFilesStartsOldestFirst(t *testing.T) {
+	dir := t.TempDir()
+	// 遍历顺序为a、b、c, 修改时间则是c最早
+	names := []string{"a.log", "b.log", "c.log"}
+	now := time.Now()
+	for i, name := range names {
+		filePath := filepath.Join(dir, name)
+		if err := os.WriteFile(filePath, []byte("l1\nLOG_COMPLETE\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(-time.Duration(i+1) * time.Minute)
+		if err := os.Chtimes(filePath, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var mu sync.Mutex
+	var started []string
+	w := startWatcher(t, WithDir(dir), WithMaxConcurrentFiles(1), WithOnFileStart(func(filePath string) {
+		mu.Lock()
+		defer mu.Unlock()
+		started = append(started, filepath.Base(filePath))
+	}))
+	receiveFiles(t, w, []string{filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log"), filepath.Join(dir, "c.log")}, 50*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"c.log", "b.log", "a.log"}; !slices.Equal(started, want) {
+		t.Errorf("开始监听的顺序 = %v, want %v", started, want)
+	}
+}
@@ -0,0 +1,60 @@
+package filewatch
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Profile 一类文件的监听配置, 匹配Regexp的文件使用该配置代替全局配置.
+// CompleteMarker为空、MaxNoUpdateTime为0时沿用全局配置, RemoveAfterComplete始终以Profile为准
+type Profile struct {
+	Name                string            // 配置名称, 记录在FileContent.Profile中, 为空时使用Regexp
+	Regexp              string            // 文件名正则表达式, 匹配方式与WithFileRegexp相同
+	CompleteMarker      string            // 结束标志符
+	RemoveAfterComplete bool              // 读取完毕后是否删除文件
+	MaxNoUpdateTime     time.Duration     // 最大未更新时间
+	Tags                map[string]string // 附加标签, 原样记录在FileContent.Tags中
+}
+
+// WithProfile 添加一类文件的监听配置, 与WithFilePattern共用同一匹配列表, 按添加顺序依次匹配,
+// 首个匹配的为Profile时以其配置监听该文件; 未添加任何表达式时所有文件使用全局配置
+func WithProfile(p Profile) Option {
+	return func(w *FileWatcher) error {
+		if p.Regexp == "" {
+			return fmt.Errorf("%w: Profile(%s)未设置文件名正则表达式", ErrInvalidRegexp, p.Name)
+		}
+		if p.MaxNoUpdateTime < 0 {
+			return fmt.Errorf("%w, Profile(%s)当前: %v", ErrInvalidMaxNoUpdateTime, p.Name, p.MaxNoUpdateTime)
+		}
+		re, err := compileFileRegexp(p.Regexp, w.caseInsensitive)
+		if err != nil {
+			return err
+		}
+		if p.Name == "" {
+			p.Name = p.Regexp
+		}
+		p.Tags = maps.Clone(p.Tags)
+		w.filePatterns = append(slices.Clip(w.filePatterns), filePattern{expr: p.Regexp, re: re, profile: &p})
+		return nil
+	}
+}
+
+// AddProfile 添加一类文件的监听配置, 匹配的文件使用该配置代替全局配置
+func (w *FileWatcher) AddProfile(p Profile) error {
+	return w.configure(WithProfile(p))
+}
+
+// apply 以Profile覆盖文件的配置快照
+func (p *Profile) apply(cfg *fileConfig) {
+	if p.CompleteMarker != "" {
+		cfg.completeMarker = p.CompleteMarker
+	}
+	if p.MaxNoUpdateTime > 0 {
+		cfg.maxNoUpdateTime = p.MaxNoUpdateTime
+	}
+	cfg.removeAfterComplete = p.RemoveAfterComplete
+	cfg.profile = p.Name
+	cfg.tags = p.Tags
+}
@@ -0,0 +1,381 @@
+package filewatch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// fileReader 从游标处开始读取的文件
+type fileReader struct {
+	f           *os.File
+	reader      io.Reader
+	offset      int64 // 打开时游标记录的偏移量, 压缩文件为解压后的偏移量
+	line        int64 // 偏移量之前的行数
+	consumed    int64 // 打开后scanner已扫描出的各行(含换行符)的字节数
+	closeReader func()
+	skipped     bool // 文件超过大小限制, 已跳至末尾
+	truncated   bool // 游标超过文件大小, 已重置
+}
+
+// Close 关闭解压器及文件
+func (fr *fileReader) Close() {
+	if fr.closeReader != nil {
+		fr.closeReader()
+	}
+	fr.f.Close()
+}
+
+// position 已扫描出的最后一行末尾对应的偏移量, 不包含scanner预读的部分
+func (fr *fileReader) position() int64 {
+	return fr.offset + fr.consumed
+}
+
+// cursor 生成读取到offset处的游标, 并记录文件的当前标识
+func (fr *fileReader) cursor(offset, line int64) Cursor {
+	c := Cursor{Offset: offset, Line: line}
+	// 无法获取文件标识时只保存偏移量, 恢复时视为同一文件
+	c.identify(fr.f)
+	return c
+}
+
+// openFile 打开文件并定位到游标记录的位置, 游标文件损坏(包括为空)时视配置从头读取并上报ErrBadCursor, 或返回ErrBadCursor.
+// 文件超过大小限制时不打开, 返回ErrFileTooLarge; 设置了跳至末尾时从文件末尾开始读取
+func (w *FileWatcher) openFile(filePath string) (*fileReader, error) {
+	// 超过大小限制的文件不打开, 避免误读大文件
+	var skipTo int64 = -1
+	if w.maxFileSize > 0 {
+		info, err := os.Stat(w.resolvePath(filePath))
+		if err != nil {
+			return nil, fmt.Errorf("查询文件信息时失败: %w", wrapPermission(filePath, err))
+		}
+		if info.Size() > w.maxFileSize {
+			if !w.tailOversize || (w.decompress && isCompressed(filePath)) {
+				return nil, fmt.Errorf("%w: %s, 大小: %d, 限制: %d", ErrFileTooLarge, filePath, info.Size(), w.maxFileSize)
+			}
+			skipTo = info.Size()
+		}
+	}
+	f, err := os.OpenFile(w.resolvePath(filePath), os.O_RDONLY, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %w", wrapPermission(filePath, err))
+	}
+	fr := &fileReader{
+		f:      f,
+		reader: f,
+	}
+	// 压缩文件本身即为二进制, 设置了解压时不检查
+	if w.skipBinary && !(w.decompress && isCompressed(filePath)) {
+		binary, err := looksBinary(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("检查文件内容失败: %w", err)
+		}
+		if binary {
+			f.Close()
+			return nil, fmt.Errorf("%w: %s", ErrBinaryFile, filePath)
+		}
+	}
+
+	compressed := w.decompress && isCompressed(filePath)
+	cursor, err := w.cursors().Load(filePath)
+	offset, line := cursor.Offset, cursor.Line
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		if w.refuseBadCursor {
+			f.Close()
+			return nil, fmt.Errorf("%w: %s: %v", ErrBadCursor, filePath, err)
+		}
+		// 交由错误处理函数上报, 调用方可通过errors.Is(err, ErrBadCursor)识别
+		w.handleErr(fmt.Errorf("%w, 将从头读取文件: %s: %v", ErrBadCursor, filePath, err))
+		offset, line = 0, 0
+	} else if err == nil {
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("查询文件信息时失败: %w", err)
+		}
+		// 游标超过文件大小时文件已被截断, 继续从游标处读取将永远读不到新内容.
+		// 压缩文件的游标为解压后的偏移量, 不与文件大小比较
+		if !compressed && offset > info.Size() {
+			w.warn("游标超过文件大小, 文件已被截断", slog.String("file", filePath),
+				slog.Int64("offset", offset), slog.Int64("size", info.Size()), slog.Bool("toEnd", w.truncateToEnd))
+			offset, line = 0, 0
+			if w.truncateToEnd {
+				offset = info.Size()
+			}
+			fr.truncated = true
+		} else if same, err := cursor.sameFile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("校验文件标识失败: %w", err)
+		} else if !same {
+			w.warn("文件已被替换, 将从头读取文件", slog.String("file", filePath), slog.Int64("offset", offset))
+			offset, line = 0, 0
+		}
+	}
+	// 旧版本的游标没有文件标识, 打开后立即以新格式保存
+	upgrade := err == nil && !cursor.identified() && offset > 0
+	if skipTo > offset {
+		w.warn("文件超过大小限制, 跳过已有内容, 只读取新增内容", slog.String("file", filePath),
+			slog.Int64("size", skipTo), slog.Int64("limit", w.maxFileSize), slog.Int64("skipped", skipTo-offset))
+		offset, line = skipTo, 0
+	}
+	fr.offset = offset
+	fr.skipped = skipTo >= 0
+
+	// 压缩文件视为一个整体: 文件标识(inode、开头内容)针对压缩文件本身校验, 恢复时从头解压并跳过游标记录的行数.
+	// 游标中的偏移量为解压后的偏移量, 仅用于兼容只记录了偏移量的旧版本游标
+	if compressed {
+		dr, closeReader, err := newDecompressReader(filePath, f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("创建解压器失败: %w", err)
+		}
+		br := bufio.NewReader(dr)
+		fr.reader, fr.closeReader = br, closeReader
+		if line > 0 {
+			offset, _, err = skipDecompressedLines(br, line)
+		} else {
+			line, err = skipDecompressed(br, offset)
+		}
+		if err != nil {
+			fr.Close()
+			return nil, fmt.Errorf("跳过已读取的压缩内容失败: %w", err)
+		}
+		fr.offset = offset
+	} else {
+		// 旧版本的游标、跳至末尾等情况下不知道已读取的行数, 需统计一次
+		if line == 0 && offset > 0 {
+			if line, err = countLines(f, offset); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("统计已读取的行数失败: %w", err)
+			}
+		}
+		if _, err = f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("设置初始seek失败: %w", err)
+		}
+	}
+	fr.line = line
+	// 截断后重置的游标立即保存
+	if upgrade || fr.truncated {
+		if err := w.saveCursor(filePath, fr.cursor(offset, line)); err != nil {
+			w.warn("保存游标失败", slog.String("file", filePath), slog.Any("err", err))
+		}
+	}
+	return fr, nil
+}
+
+// countLines 统计文件前n个字节中的行数
+func countLines(f *os.File, n int64) (int64, error) {
+	var lines int64
+	buf := make([]byte, 32*1024)
+	r := io.NewSectionReader(f, 0, n)
+	for {
+		m, err := r.Read(buf)
+		lines += int64(bytes.Count(buf[:m], []byte{'\n'}))
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+}
+
+// cursorPath 获取文件对应的游标文件路径.
+// 设置了游标目录时以文件绝对路径的SHA-256命名, 避免路径穿越和重名, 否则存放在文件旁
+func (w *FileWatcher) cursorPath(filePath string) string {
+	if w.cursorDir == "" {
+		return w.siblingCursorPath(filePath)
+	}
+	key := fileKey(filePath)
+	if w.caseInsensitive {
+		key = strings.ToLower(key)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(w.cursorDir, hex.EncodeToString(sum[:])+CursorFileSuffix)
+}
+
+// siblingCursorPath 获取存放在文件旁的游标文件路径
+func (w *FileWatcher) siblingCursorPath(filePath string) string {
+	name := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	if w.caseInsensitive {
+		// 忽略大小写时游标文件名统一为小写, 只转换文件名部分, 文件夹保持原样
+		name = filepath.Join(filepath.Dir(name), strings.ToLower(filepath.Base(name)))
+	}
+	return name + CursorFileSuffix
+}
+
+// migrateCursor 设置了游标目录但其中还没有该文件的游标时, 导入文件旁旧的游标文件并尝试删除旧文件
+func (w *FileWatcher) migrateCursor(filePath, cursorFile string) {
+	if w.cursorDir == "" {
+		return
+	}
+	if _, err := os.Stat(cursorFile); !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	legacy := w.siblingCursorPath(filePath)
+	cursor, err := readCursorFile(legacy)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			w.warn("旧的游标文件已损坏, 不导入", slog.String("cursor", legacy), slog.Any("err", err))
+		}
+		return
+	}
+	cursor.Path = fileKey(filePath)
+	if err = w.prepareCursorDir(); err == nil {
+		err = writeCursorFile(cursorFile, cursor, w.cursorSync)
+	}
+	if err != nil {
+		w.errorf("导入旧的游标文件(%s)失败: %w", legacy, err)
+		return
+	}
+	// 监控文件夹可能只读, 删除失败不影响使用
+	os.Remove(legacy)
+	w.info("已导入旧的游标文件", slog.String("file", filePath), slog.String("cursor", legacy), slog.Int64("offset", cursor.Offset))
+}
+
+// prepareCursorDir 设置了游标目录且其不存在时先创建
+func (w *FileWatcher) prepareCursorDir() error {
+	if w.cursorDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(w.cursorDir, 0755); err != nil {
+		return fmt.Errorf("创建游标目录失败: %w", err)
+	}
+	return nil
+}
+
+// tailCursor 文件没有游标时, 以当前文件大小作为初始游标, 使之后只读取新增的内容
+func (w *FileWatcher) tailCursor(filePath string) error {
+	// 游标已损坏时交由openFile处理
+	if _, err := w.cursors().Load(filePath); !errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	f, err := os.Open(w.resolvePath(filePath))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var c Cursor
+	if err = c.identify(f); err != nil {
+		return err
+	}
+	c.Offset = c.Size
+	// 压缩文件按解压后的行数恢复, 需解压一遍统计全部内容
+	if w.decompress && isCompressed(filePath) {
+		dr, closeReader, err := newDecompressReader(filePath, f)
+		if err != nil {
+			return fmt.Errorf("创建解压器失败: %w", err)
+		}
+		defer closeReader()
+		if c.Offset, c.Line, err = skipDecompressedLines(bufio.NewReader(dr), -1); err != nil {
+			return fmt.Errorf("统计压缩文件的行数失败: %w", err)
+		}
+	}
+	return w.saveCursor(filePath, c)
+}
+
+// binarySniffSize 判断是否为二进制文件时检查的文件开头的字节数
+const binarySniffSize = 8 * 1024
+
+// looksBinary 检查文件开头的内容, 含有NUL字节或不合法的UTF-8字节超过三成时认为是二进制文件.
+// 使用ReadAt读取, 不影响文件的读取位置
+func looksBinary(f *os.File) (bool, error) {
+	buf := make([]byte, binarySniffSize)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	buf = buf[:n]
+	if bytes.IndexByte(buf, 0) >= 0 {
+		return true, nil
+	}
+	invalid := 0
+	for i := 0; i < len(buf); {
+		r, size := utf8.DecodeRune(buf[i:])
+		// 末尾被截断的字符不计入
+		if r == utf8.RuneError && size == 1 && (len(buf)-i >= utf8.UTFMax || utf8.FullRune(buf[i:])) {
+			invalid++
+		}
+		i += size
+	}
+	return invalid*10 > len(buf)*3, nil
+}
+
+// rotationPollInterval 文件轮转时检查新文件是否出现的间隔
+const rotationPollInterval = 100 * time.Millisecond
+
+// waitRecreated 在轮转等待时长内等待同名的新文件出现
+func (w *FileWatcher) waitRecreated(ctx context.Context, filePath string) bool {
+	deadline := time.NewTimer(w.rotationGrace)
+	defer deadline.Stop()
+	ticker := time.NewTicker(rotationPollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := os.Stat(filePath); err == nil {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline.C:
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// reopenRotated 将游标重置为0后打开轮转产生的新文件
+func (w *FileWatcher) reopenRotated(filePath string) (*fileReader, error) {
+	if err := w.saveCursor(filePath, Cursor{}); err != nil {
+		return nil, err
+	}
+	return w.openFile(filePath)
+}
+
+// newScanner 创建按行读取fr的scanner, 缓冲区按需增长至单行最大长度.
+// 扫描出的每行的字节数计入fr.consumed, 使保存的游标恰好位于已发送内容的末尾, 而不是scanner预读到的位置
+func (w *FileWatcher) newScanner(fr *fileReader) *bufio.Scanner {
+	limit := w.maxLineBytes
+	if limit <= 0 {
+		limit = DefaultMaxLineBytes
+	}
+	scanner := bufio.NewScanner(fr.reader)
+	scanner.Buffer(make([]byte, 0, min(bufio.MaxScanTokenSize, limit)), limit)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		fr.consumed += int64(advance)
+		return advance, token, err
+	})
+	return scanner
+}
+
+// processLine 处理读取到的一行, 返回处理后的内容、是否为结束标记以及是否需要发送.
+// 被过滤的行不发送, 但游标照常推进; 结束标记行不受过滤和转换的影响
+func (w *FileWatcher) processLine(line []byte, cfg fileConfig) ([]byte, bool, bool) {
+	// 先比较字符串, 不相等时再匹配正则表达式
+	eof := string(line) == cfg.completeMarker || (cfg.completeMarkerRe != nil && cfg.completeMarkerRe.Match(line))
+	if eof {
+		return line, true, true
+	}
+	if w.lineFilter != nil && !w.lineFilter(line) {
+		return line, false, false
+	}
+	if w.lineTransformer != nil {
+		line = w.lineTransformer(line)
+	}
+	return line, false, true
+}
@@ -0,0 +1,218 @@
+package filewatch
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// fileConfig 单个文件开始监听时的配置快照, 监听期间不受Reconfigure影响
+type fileConfig struct {
+	completeMarker      string
+	completeMarkerRe    *regexp.Regexp
+	maxNoUpdateTime     time.Duration
+	removeAfterComplete bool
+	pattern             string // 文件匹配的表达式, 未添加文件名表达式时为空
+	profile             string // 文件使用的Profile名称, 使用全局配置时为空
+	tags                map[string]string
+}
+
+// Reconfigure 修改配置, 未运行时等同于依次设置各配置项.
+// 运行中(包括直接调用Watch、DrainOnce读取期间)仅允许修改文件名glob模式或正则表达式(包括添加的表达式与Profile)及其匹配方式、排除的文件名正则表达式、结束标志符与最大未更新时间, 修改只对之后新发现的文件生效,
+// 已在监听的文件沿用原配置; 包含其他配置项时返回ErrNotReconfigurable, 且所有配置均不生效
+func (w *FileWatcher) Reconfigure(opts ...Option) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// 先在副本上应用, 全部合法后再写回
+	scratch := &FileWatcher{settings: w.settings, ResChan: w.ResChan}
+	for _, opt := range opts {
+		if err := opt(scratch); err != nil {
+			return err
+		}
+	}
+	if !w.busy() {
+		w.settings = scratch.settings
+		return nil
+	}
+
+	if name := w.settings.fixedChanged(&scratch.settings); name != "" {
+		return fmt.Errorf("%w: %s", ErrNotReconfigurable, name)
+	}
+	if scratch.fileGlob != "" && scratch.fileRegexp != "" {
+		return ErrGlobAndRegexp
+	}
+	if len(scratch.filePatterns) > 0 && (scratch.fileGlob != "" || scratch.fileRegexp != "") {
+		return ErrPatternConflict
+	}
+	w.fileGlob = scratch.fileGlob
+	w.fileRegexp = scratch.fileRegexp
+	w.fileRe = scratch.fileRe
+	w.filePatterns = scratch.filePatterns
+	w.excludeFileRegexp = scratch.excludeFileRegexp
+	w.excludeFileRe = scratch.excludeFileRe
+	w.matchBaseName = scratch.matchBaseName
+	w.completeMarker = scratch.completeMarker
+	w.completeMarkerRe = scratch.completeMarkerRe
+	w.maxNoUpdateTime = scratch.maxNoUpdateTime
+	return nil
+}
+
+// fixedChanged 返回运行中不允许修改却被修改了的配置项名称, 均未修改时返回空
+func (s *settings) fixedChanged(o *settings) string {
+	switch {
+	case !slices.Equal(s.dirPaths, o.dirPaths):
+		return "dirPaths"
+	case s.removeAfterComplete != o.removeAfterComplete:
+		return "removeAfterComplete"
+	case s.stopTimeout != o.stopTimeout:
+		return "stopTimeout"
+	case s.rescanInterval != o.rescanInterval:
+		return "rescanInterval"
+	case s.pollingInterval != o.pollingInterval:
+		return "pollingInterval"
+	case s.maxConcurrentFiles != o.maxConcurrentFiles:
+		return "maxConcurrentFiles"
+	case s.createDirPerm != o.createDirPerm:
+		return "createDirPerm"
+	case s.waitForDir != o.waitForDir:
+		return "waitForDir"
+	case s.maxBatchBytes != o.maxBatchBytes:
+		return "maxBatchBytes"
+	case s.flushInterval != o.flushInterval:
+		return "flushInterval"
+	case s.subscribePolicy != o.subscribePolicy:
+		return "subscribePolicy"
+	case s.compressContent != o.compressContent:
+		return "compressContent"
+	case s.maxFileSize != o.maxFileSize:
+		return "maxFileSize"
+	case s.maxLineBytes != o.maxLineBytes:
+		return "maxLineBytes"
+	case s.truncateToEnd != o.truncateToEnd:
+		return "truncateToEnd"
+	case s.tailOversize != o.tailOversize:
+		return "tailOversize"
+	case s.skipBinary != o.skipBinary:
+		return "skipBinary"
+	case s.deferEmpty != o.deferEmpty:
+		return "deferEmpty"
+	case s.cursorDir != o.cursorDir:
+		return "cursorDir"
+	case s.cursorSync != o.cursorSync:
+		return "cursorSync"
+	case s.cursorSaveInterval != o.cursorSaveInterval:
+		return "cursorSaveInterval"
+	case s.cursorGranularity != o.cursorGranularity:
+		return "cursorGranularity"
+	case s.ackMode != o.ackMode:
+		return "ackMode"
+	case s.ackTimeout != o.ackTimeout:
+		return "ackTimeout"
+	case s.rotationGrace != o.rotationGrace:
+		return "rotationGrace"
+	case s.caseInsensitive != o.caseInsensitive:
+		return "caseInsensitive"
+	case s.minFileAge != o.minFileAge:
+		return "minFileAge"
+	case s.tailExisting != o.tailExisting:
+		return "tailExisting"
+	case s.refuseBadCursor != o.refuseBadCursor:
+		return "refuseBadCursor"
+	case s.decompress != o.decompress:
+		return "decompress"
+	case s.recursive != o.recursive:
+		return "recursive"
+	case s.maxDepth != o.maxDepth:
+		return "maxDepth"
+	case s.excludeDirRe != o.excludeDirRe:
+		return "excludeDirRe"
+	case s.ignoreHidden != o.ignoreHidden:
+		return "ignoreHidden"
+	case s.followSymlinks != o.followSymlinks:
+		return "followSymlinks"
+	case !sameFunc(s.recordDelimiter, o.recordDelimiter):
+		return "recordDelimiter"
+	case !sameFunc(s.lineFilter, o.lineFilter):
+		return "lineFilter"
+	case !sameFunc(s.lineTransformer, o.lineTransformer):
+		return "lineTransformer"
+	case !sameFunc(s.onFileStart, o.onFileStart):
+		return "onFileStart"
+	case !sameFunc(s.onFileComplete, o.onFileComplete):
+		return "onFileComplete"
+	case s.logger != o.logger:
+		return "logger"
+	case !sameFunc(s.errorHandler, o.errorHandler):
+		return "errorHandler"
+	case !sameFunc(s.logHandler, o.logHandler):
+		return "logHandler"
+	case s.statsObserver != o.statsObserver:
+		return "statsObserver"
+	case s.cursorStore != o.cursorStore:
+		return "cursorStore"
+	}
+	return ""
+}
+
+// sameFunc 函数无法直接比较, 以其地址判断是否为同一个函数
+func sameFunc(a, b any) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+// fileConfig 获取文件开始监听时当前配置的快照
+func (w *FileWatcher) fileConfig(filePath string) fileConfig {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	cfg := fileConfig{
+		completeMarker:      w.completeMarker,
+		completeMarkerRe:    w.completeMarkerRe,
+		maxNoUpdateTime:     w.maxNoUpdateTime,
+		removeAfterComplete: w.removeAfterComplete,
+	}
+	name := filePath
+	if w.matchBaseName {
+		name = filepath.Base(filePath)
+	}
+	if p, ok := matchPattern(w.filePatterns, name); ok {
+		cfg.pattern = p.expr
+		if p.profile != nil {
+			p.profile.apply(&cfg)
+		}
+	}
+	return cfg
+}
+
+// matchFile 判断root下的文件是否匹配当前的glob模式或正则表达式, 且未被排除的文件名正则表达式匹配
+func (w *FileWatcher) matchFile(root, filePath string) bool {
+	w.mu.Lock()
+	re, glob, base, fold := w.fileRe, w.fileGlob, w.matchBaseName, w.caseInsensitive
+	exclude, patterns := w.excludeFileRe, w.filePatterns
+	w.mu.Unlock()
+	name := filePath
+	if base {
+		name = filepath.Base(filePath)
+	}
+	if exclude != nil && exclude.MatchString(name) {
+		return false
+	}
+	if len(patterns) > 0 {
+		_, ok := matchPattern(patterns, name)
+		return ok
+	}
+	if glob != "" {
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			rel = filepath.Base(filePath)
+		}
+		if fold {
+			glob, rel = strings.ToLower(glob), strings.ToLower(rel)
+		}
+		return matchGlob(glob, rel)
+	}
+	return len(re.FindStringSubmatch(name)) > 0
+}
@@ -0,0 +1,69 @@
+package filewatch
+
+import "context"
+
+// Run 异步监控任务的句柄
+type Run struct {
+	w    *FileWatcher
+	done chan struct{}
+	err  error
+}
+
+// StartAsync 在后台开始监控任务, 初始化失败(如文件夹不存在、创建监控器失败)时直接返回错误
+func (w *FileWatcher) StartAsync() (*Run, error) {
+	r := &Run{w: w, done: make(chan struct{})}
+	ready := make(chan error, 1)
+	go func() {
+		defer close(r.done)
+		r.err = w.start(context.Background(), ready)
+	}()
+	if err := <-ready; err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Restart 监控任务因错误退出后, 在原watcher上重新开始监控, 各文件从已保存的游标处继续读取.
+// 会先等待上一次任务的剩余协程退出, 已发送且游标已保存的内容不会重复发送.
+// 重启后沿用原来的结果通道, 消费者无需重新获取; 只有调用过Stop(结果通道已关闭)时才会创建新的结果通道.
+// 监控任务仍在运行时返回ErrAlreadyWatching, 初始化失败时返回对应错误
+func (w *FileWatcher) Restart() error {
+	if w.Watching() {
+		return ErrAlreadyWatching
+	}
+	// 清理上一次任务遗留的协程(如直接调用Watch的), 确保其游标均已保存, 不关闭结果通道
+	done, _ := w.teardown(false)
+	<-done
+
+	r, err := w.StartAsync()
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-r.Done()
+		if err := r.Err(); err != nil {
+			w.errorf("重启后的监控任务异常退出: %w", err)
+		}
+	}()
+	return nil
+}
+
+// Done 返回一个通道, 监控任务结束后关闭
+func (r *Run) Done() <-chan struct{} {
+	return r.done
+}
+
+// Err 返回监控任务结束的原因, 需在Done关闭后调用, 任务未结束时返回nil
+func (r *Run) Err() error {
+	select {
+	case <-r.done:
+		return r.err
+	default:
+		return nil
+	}
+}
+
+// Stop 停止监控任务, 同FileWatcher.Stop
+func (r *Run) Stop() error {
+	return r.w.Stop()
+}
@@ -0,0 +1,85 @@
+package filewatch
+
+import (
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Stats 监控任务的统计信息
+type Stats struct {
+	LinesRead       int64 // 已读取的行数
+	BytesRead       int64 // 已读取的字节数
+	FilesCompleted  int64 // 读取到结束标记的文件数
+	FilesErrored    int64 // 监听出错的文件数
+	ActiveFiles     int64 // 正在监听的文件数
+	ContentsDropped int64 // 因订阅者通道已满而丢弃的内容数
+}
+
+// Stats 获取统计信息的快照
+func (w *FileWatcher) Stats() Stats {
+	return Stats{
+		LinesRead:       atomic.LoadInt64(&w.stats.LinesRead),
+		BytesRead:       atomic.LoadInt64(&w.stats.BytesRead),
+		FilesCompleted:  atomic.LoadInt64(&w.stats.FilesCompleted),
+		FilesErrored:    atomic.LoadInt64(&w.stats.FilesErrored),
+		ActiveFiles:     atomic.LoadInt64(&w.stats.ActiveFiles),
+		ContentsDropped: atomic.LoadInt64(&w.stats.ContentsDropped),
+	}
+}
+
+// StatsObserver 接收与Stats同步的统计事件, 可用于对接外部监控系统.
+// dirPath为文件所属的监控文件夹, 单独监听的文件为空
+type StatsObserver interface {
+	FileStarted(dirPath, filePath string)
+	FileStopped(dirPath, filePath string)
+	LineRead(dirPath, filePath string, bytes int)
+	FileCompleted(dirPath, filePath string)
+	FileErrored(dirPath, filePath string)
+}
+
+func (w *FileWatcher) fileStarted(dirPath, filePath string) {
+	atomic.AddInt64(&w.stats.ActiveFiles, 1)
+	if w.statsObserver != nil {
+		w.statsObserver.FileStarted(dirPath, filePath)
+	}
+}
+
+func (w *FileWatcher) fileStopped(dirPath, filePath string) {
+	atomic.AddInt64(&w.stats.ActiveFiles, -1)
+	if w.statsObserver != nil {
+		w.statsObserver.FileStopped(dirPath, filePath)
+	}
+}
+
+func (w *FileWatcher) lineRead(dirPath, filePath string, bytes int) {
+	atomic.AddInt64(&w.stats.LinesRead, 1)
+	atomic.AddInt64(&w.stats.BytesRead, int64(bytes))
+	if w.statsObserver != nil {
+		w.statsObserver.LineRead(dirPath, filePath, bytes)
+	}
+}
+
+func (w *FileWatcher) fileCompleted(dirPath, filePath string) {
+	atomic.AddInt64(&w.stats.FilesCompleted, 1)
+	if w.statsObserver != nil {
+		w.statsObserver.FileCompleted(dirPath, filePath)
+	}
+}
+
+func (w *FileWatcher) fileErrored(dirPath, filePath string) {
+	atomic.AddInt64(&w.stats.FilesErrored, 1)
+	if w.statsObserver != nil {
+		w.statsObserver.FileErrored(dirPath, filePath)
+	}
+}
+
+// dirOf 获取文件所属的监控文件夹, 不属于任何监控文件夹时(如通过WatchFile监听)返回文件所在的文件夹
+func (w *FileWatcher) dirOf(filePath string) string {
+	abs := fileKey(filePath)
+	for _, dirPath := range w.currentDirs() {
+		if isSubDir(fileKey(dirPath), abs) {
+			return dirPath
+		}
+	}
+	return filepath.Dir(filePath)
+}
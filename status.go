@@ -0,0 +1,173 @@
+package filewatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// FileStatus 正在监听的文件状态
+type FileStatus struct {
+	Path         string
+	Offset       int64     // 已读取到的位置
+	LinesRead    int64     // 本次监听已读取的行数
+	StartedAt    time.Time // 开始监听的时间
+	LastActivity time.Time // 最近一次读取到内容的时间
+	Size         int64     // 文件当前大小
+	Lag          int64     // 尚未读取的字节数, 即Size-Offset
+	Pending      bool      // 是否在排队等待空闲名额, 排队中的文件仅Path有效
+}
+
+// WatchedFiles 获取当前正在监听的文件及其状态, 按路径排序
+func (w *FileWatcher) WatchedFiles() []FileStatus {
+	w.filesMu.Lock()
+	defer w.filesMu.Unlock()
+	res := make([]FileStatus, 0, len(w.files))
+	for _, wf := range w.files {
+		res = append(res, wf.status)
+	}
+	for _, filePath := range w.pendingFiles() {
+		res = append(res, FileStatus{Path: filePath, Pending: true})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Path < res[j].Path })
+	for i := range res {
+		res[i].fillLag()
+	}
+	return res
+}
+
+// FileStatus 查询正在监听的文件状态, 包含文件当前大小及读取延迟, 未在监听时返回false
+func (w *FileWatcher) FileStatus(filePath string) (FileStatus, bool) {
+	w.filesMu.Lock()
+	wf, ok := w.files[fileKey(filePath)]
+	var res FileStatus
+	if ok {
+		res = wf.status
+	}
+	w.filesMu.Unlock()
+	if !ok {
+		key := fileKey(filePath)
+		for _, pending := range w.pendingFiles() {
+			if fileKey(pending) == key {
+				res = FileStatus{Path: pending, Pending: true}
+				res.fillLag()
+				return res, true
+			}
+		}
+		return FileStatus{}, false
+	}
+	res.fillLag()
+	return res, true
+}
+
+// fillLag 查询文件当前大小并计算读取延迟
+func (st *FileStatus) fillLag() {
+	info, err := os.Stat(st.Path)
+	if err != nil {
+		return
+	}
+	st.Size = info.Size()
+	st.Lag = st.Size - st.Offset
+	if st.Lag < 0 {
+		st.Lag = 0
+	}
+}
+
+// watchedFile 正在监听的文件, cancel用于单独结束该文件的监听
+type watchedFile struct {
+	status   FileStatus
+	cancel   context.CancelFunc
+	replaced chan struct{} // 目录中同名文件被创建时通知, 由监听协程核对文件是否已被替换
+}
+
+// registerFile 登记开始监听的文件
+func (w *FileWatcher) registerFile(filePath string, offset int64, cancel context.CancelFunc) *watchedFile {
+	now := time.Now()
+	wf := &watchedFile{
+		status:   FileStatus{Path: filePath, Offset: offset, StartedAt: now, LastActivity: now},
+		cancel:   cancel,
+		replaced: make(chan struct{}, 1),
+	}
+	w.filesMu.Lock()
+	defer w.filesMu.Unlock()
+	if w.files == nil {
+		w.files = make(map[string]*watchedFile)
+	}
+	w.files[fileKey(filePath)] = wf
+	return wf
+}
+
+// updateFile 更新文件的读取进度
+func (w *FileWatcher) updateFile(wf *watchedFile, offset int64) {
+	w.filesMu.Lock()
+	defer w.filesMu.Unlock()
+	wf.status.Offset = offset
+	wf.status.LinesRead++
+	wf.status.LastActivity = time.Now()
+}
+
+// unregisterFile 注销结束监听的文件
+func (w *FileWatcher) unregisterFile(wf *watchedFile) {
+	w.filesMu.Lock()
+	defer w.filesMu.Unlock()
+	key := fileKey(wf.status.Path)
+	if w.files[key] == wf {
+		delete(w.files, key)
+	}
+}
+
+// notifyReplaced 通知正在监听该文件的协程核对文件是否已被替换, 已有未处理的通知时忽略
+func (w *FileWatcher) notifyReplaced(filePath string) {
+	w.filesMu.Lock()
+	defer w.filesMu.Unlock()
+	wf, ok := w.files[fileKey(filePath)]
+	if !ok {
+		return
+	}
+	select {
+	case wf.replaced <- struct{}{}:
+	default:
+	}
+}
+
+// claimFile 标记文件开始被读取, 若已有协程在读取则返回false
+func (w *FileWatcher) claimFile(filePath string) bool {
+	_, loaded := w.activeFiles.LoadOrStore(fileKey(filePath), struct{}{})
+	return !loaded
+}
+
+// releaseFile 标记文件读取结束, 文件被重新创建后可再次监听
+func (w *FileWatcher) releaseFile(filePath string) {
+	w.activeFiles.Delete(fileKey(filePath))
+}
+
+// isWatched 判断文件是否已有协程在读取
+func (w *FileWatcher) isWatched(filePath string) bool {
+	_, ok := w.activeFiles.Load(fileKey(filePath))
+	return ok
+}
+
+// fileKey 将文件路径统一为绝对路径, 避免同一文件因写法不同被重复读取
+func fileKey(filePath string) string {
+	if abs, err := filepath.Abs(filePath); err == nil {
+		return abs
+	}
+	return filepath.Clean(filePath)
+}
+
+// cancelFilesUnder 结束dirPath下所有文件的监听, 各文件会先发送剩余内容并保存游标
+func (w *FileWatcher) cancelFilesUnder(dirPath string) {
+	absDir, err := filepath.Abs(dirPath)
+	if err != nil {
+		return
+	}
+	w.filesMu.Lock()
+	defer w.filesMu.Unlock()
+	for key, wf := range w.files {
+		if isSubDir(absDir, key) {
+			wf.cancel()
+		}
+	}
+}
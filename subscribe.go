@@ -0,0 +1,138 @@
+package filewatch
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// SubscribePolicy 订阅者通道已满时的处理方式
+type SubscribePolicy int
+
+const (
+	SubscribeDrop  SubscribePolicy = iota // 丢弃该订阅者的本条内容, 不影响其他订阅者
+	SubscribeBlock                        // 等待该订阅者读取, 期间其他订阅者也收不到后续内容
+)
+
+// subscriberBufferSize 订阅者通道的缓冲大小
+const subscriberBufferSize = 100
+
+// contentSubscribers 结果通道的各订阅者
+type contentSubscribers struct {
+	mu     sync.Mutex
+	subs   map[<-chan FileContent]*contentSubscriber
+	source chan FileContent // 正在分发的结果通道
+}
+
+// contentSubscriber 单个订阅者
+type contentSubscriber struct {
+	mu     sync.Mutex // 发送与关闭互斥, 避免向已关闭的通道发送
+	ch     chan FileContent
+	source chan FileContent // 订阅时的结果通道, 该通道关闭时订阅随之结束
+	done   chan struct{}    // 取消订阅时关闭, 唤醒阻塞中的发送
+	closed bool
+}
+
+// Subscribe 订阅结果通道, 返回一个独立的通道, 每条内容都会分发给所有订阅者.
+// 首次订阅后结果通道由内部协程读取并分发, 不能再直接读取ResChan; 订阅者通道已满时按SubscribePolicy处理.
+// 监控任务停止、结果通道关闭后订阅者通道随之关闭, 重新Start后需再次订阅
+func (w *FileWatcher) Subscribe() <-chan FileContent {
+	w.mu.Lock()
+	source := w.ResChan
+	w.mu.Unlock()
+	sub := &contentSubscriber{
+		ch:     make(chan FileContent, subscriberBufferSize),
+		source: source,
+		done:   make(chan struct{}),
+	}
+	w.subscribers.mu.Lock()
+	defer w.subscribers.mu.Unlock()
+	if w.subscribers.subs == nil {
+		w.subscribers.subs = make(map[<-chan FileContent]*contentSubscriber)
+	}
+	w.subscribers.subs[sub.ch] = sub
+	if w.subscribers.source != source {
+		w.subscribers.source = source
+		go w.fanOut(source)
+	}
+	return sub.ch
+}
+
+// Unsubscribe 取消订阅并关闭订阅者通道, ch需为Subscribe返回的通道
+func (w *FileWatcher) Unsubscribe(ch <-chan FileContent) {
+	w.subscribers.mu.Lock()
+	sub, ok := w.subscribers.subs[ch]
+	delete(w.subscribers.subs, ch)
+	w.subscribers.mu.Unlock()
+	if ok {
+		sub.close()
+	}
+}
+
+// fanOut 将结果通道中的内容分发给订阅了该通道的订阅者, 结果通道关闭后关闭这些订阅者的通道
+func (w *FileWatcher) fanOut(source chan FileContent) {
+	for c := range source {
+		for _, sub := range w.subscribersOf(source) {
+			if !sub.send(c, w.subscribePolicy) {
+				atomic.AddInt64(&w.stats.ContentsDropped, 1)
+				w.warn("订阅者通道已满, 丢弃内容", slog.String("file", c.FilePath))
+			}
+		}
+	}
+	w.subscribers.mu.Lock()
+	// 之后对已关闭通道的订阅由新的分发协程立即关闭
+	if w.subscribers.source == source {
+		w.subscribers.source = nil
+	}
+	for ch, sub := range w.subscribers.subs {
+		if sub.source == source {
+			delete(w.subscribers.subs, ch)
+			sub.close()
+		}
+	}
+	w.subscribers.mu.Unlock()
+}
+
+// subscribersOf 获取订阅了source的订阅者
+func (w *FileWatcher) subscribersOf(source chan FileContent) []*contentSubscriber {
+	w.subscribers.mu.Lock()
+	defer w.subscribers.mu.Unlock()
+	var subs []*contentSubscriber
+	for _, sub := range w.subscribers.subs {
+		if sub.source == source {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// send 向订阅者发送内容, 因通道已满被丢弃时返回false
+func (s *contentSubscriber) send(c FileContent, policy SubscribePolicy) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return true
+	}
+	if policy == SubscribeBlock {
+		select {
+		case s.ch <- c:
+		case <-s.done:
+		}
+		return true
+	}
+	select {
+	case s.ch <- c:
+		return true
+	default:
+		return false
+	}
+}
+
+// close 结束订阅, 先唤醒阻塞中的发送再关闭通道
+func (s *contentSubscriber) close() {
+	close(s.done)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	close(s.ch)
+}
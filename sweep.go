@@ -0,0 +1,132 @@
+package filewatch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SweepCursors 删除被监听文件已不存在的游标文件, 返回删除的数量, Scan时会自动调用.
+// 文件旁的游标文件在同一文件夹中没有对应的文件时被删除; 游标目录中的游标文件按其记录的文件路径判断,
+// 未记录路径的旧游标文件会保留至下次保存. 文件存在但无法读取、所在文件夹不存在(如未挂载)、
+// 或文件正在被监听(如等待轮转的新文件)时不删除. 使用WithCursorStore设置的存储时不做处理
+func (w *FileWatcher) SweepCursors(ctx context.Context) int {
+	if w.cursorStore != nil {
+		return 0
+	}
+	// 正在监听的文件对应的游标文件, 文件可能暂时不存在
+	watched := make(map[string]bool)
+	w.activeFiles.Range(func(key, _ any) bool {
+		filePath := key.(string)
+		watched[w.siblingCursorPath(filePath)] = true
+		watched[w.cursorPath(filePath)] = true
+		return true
+	})
+	removed := 0
+	for _, dirPath := range w.currentDirs() {
+		removed += w.sweepSiblingCursors(ctx, dirPath, watched)
+	}
+	if w.cursorDir != "" {
+		removed += w.sweepCursorDir(ctx, watched)
+	}
+	return removed
+}
+
+// sweepSiblingCursors 删除监控文件夹中没有对应文件的游标文件
+func (w *FileWatcher) sweepSiblingCursors(ctx context.Context, root string, watched map[string]bool) int {
+	removed := 0
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		// 游标目录中的游标文件以哈希命名, 另行处理
+		if !w.dirAllowed(root, path) || (w.cursorDir != "" && fileKey(path) == fileKey(w.cursorDir)) {
+			return filepath.SkipDir
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			w.errorf("读取文件夹(%s)失败, 不清理其中的游标文件: %w", path, err)
+			return nil
+		}
+		// 文件夹中现有文件对应的游标文件
+		owned := make(map[string]bool)
+		for _, e := range entries {
+			if !strings.HasSuffix(e.Name(), CursorFileSuffix) {
+				owned[w.siblingCursorPath(filepath.Join(path, e.Name()))] = true
+			}
+		}
+		for _, e := range entries {
+			cursorFile := filepath.Join(path, e.Name())
+			if e.IsDir() || !isCursorFile(e.Name()) || owned[cursorFile] || watched[fileKey(cursorFile)] {
+				continue
+			}
+			if w.removeOrphanCursor(cursorFile, "") {
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed
+}
+
+// sweepCursorDir 删除游标目录中记录的文件已不存在的游标文件
+func (w *FileWatcher) sweepCursorDir(ctx context.Context, watched map[string]bool) int {
+	entries, err := os.ReadDir(w.cursorDir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			w.errorf("读取游标目录失败, 不清理游标文件: %w", err)
+		}
+		return 0
+	}
+	removed := 0
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		cursorFile := filepath.Join(w.cursorDir, e.Name())
+		if e.IsDir() || !isCursorFile(e.Name()) || watched[cursorFile] {
+			continue
+		}
+		c, err := readCursorFile(cursorFile)
+		if err != nil || c.Path == "" || !fileGone(c.Path) {
+			continue
+		}
+		if w.removeOrphanCursor(cursorFile, c.Path) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// removeOrphanCursor 删除游标文件, filePath为游标记录的文件路径, 未知时为空
+func (w *FileWatcher) removeOrphanCursor(cursorFile, filePath string) bool {
+	if err := os.Remove(cursorFile); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			w.errorf("删除游标文件(%s)失败: %w", cursorFile, err)
+		}
+		return false
+	}
+	w.info("对应的文件已不存在, 删除游标文件", slog.String("cursor", cursorFile), slog.String("file", filePath))
+	return true
+}
+
+// isCursorFile 判断是否为游标文件, 保存游标时的临时文件不算在内
+func isCursorFile(name string) bool {
+	return strings.HasSuffix(name, CursorFileSuffix) && !strings.HasSuffix(name, ".tmp"+CursorFileSuffix)
+}
+
+// fileGone 判断文件是否确定已不存在, 文件所在的文件夹也不存在时无法确定, 返回false
+func fileGone(filePath string) bool {
+	if _, err := os.Lstat(filePath); !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	_, err := os.Stat(filepath.Dir(filePath))
+	return err == nil
+}